@@ -5,17 +5,19 @@ import (
 	"errors"
 	"math/rand"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/rs/zerolog/log"
 
 	"github.com/mrbryside/tessara"
 	"github.com/mrbryside/tessara/logger"
 )
 
 // Handler represents a custom handler for handling perform events and fallback events.
-type Handler struct{}
+type Handler struct {
+	logger logger.Logger
+}
 
 // Perform represents a custom handler for handling perform events.
 func (h Handler) Perform(pm tessara.PerformMessage) error {
@@ -25,36 +27,36 @@ func (h Handler) Perform(pm tessara.PerformMessage) error {
 		return errors.New("error from random")
 	}
 	time.Sleep(randomSleep)
-	log.Info().Msg("Message Proceed")
+	h.logger.Info("message proceed", "topic", pm.Topic, "partition", pm.Partition, "offset", pm.Offset)
 	return nil
 }
 
 // Fallback represents a custom handler for handling fallback events.
 func (h Handler) Fallback(pm tessara.PerformMessage, err error) {
-	logger.Debug().
-		Str("topic", string(pm.Topic)).
-		Int32("partition", pm.Partition).
-		Msg("fallback triggered!")
+	h.logger.Debug("fallback triggered!", "topic", pm.Topic, "partition", pm.Partition, "error", err)
 }
 
 // MyErrorHandler represents a custom error handler for handling commit give up events.
-type MyErrorHandler struct{}
+type MyErrorHandler struct {
+	logger logger.Logger
+}
 
 // HandleCommitGiveUp using for handle when message exceed commit give up time
 // you can use this function to handle the commit give up event
 func (mh MyErrorHandler) HandleCommitGiveUp(topic string, partition int32) {
-	log.Debug().
-		Str("topic", topic).
-		Int32("partition", partition).
-		Msg("commit give up handle triggered!")
+	mh.logger.Debug("commit give up handle triggered!", "topic", topic, "partition", partition)
 }
 
 func main() {
+	// logger is injected into the consumer and the handlers, it's writing to stdout when TESSARA_ENABLE_LOG is true
+	l := logger.Default()
+
 	go func() {
 		http.Handle("/metrics", promhttp.Handler())
 		err := http.ListenAndServe(":2112", nil)
 		if err != nil {
-			log.Panic().Err(err).Msg("failed to start metrics server")
+			l.Error("failed to start metrics server", "error", err)
+			os.Exit(1)
 		}
 	}()
 
@@ -75,13 +77,23 @@ func main() {
 		WithCommitGiveUpInterval(10*time.Second).
 		WithCommitGiveUpTime(40*time.Second).
 		WithBlockingInterval(10*time.Millisecond).
-		WithRetry(5, 1.5)
+		WithRetry(5, 1.5).
+		WithLogger(l)
 
-	log.Info().Msg("consumer started")
+	if err := cfg.Validate(); err != nil {
+		l.Error("invalid consumer config", "error", err)
+		os.Exit(1)
+	}
+
+	l.Info("consumer started")
 
-	tessara.
-		NewConsumer(cfg, Handler{}).
-		WithErrorHandler(MyErrorHandler{}).
+	err := tessara.
+		NewConsumer(cfg, Handler{logger: l}).
+		WithErrorHandler(MyErrorHandler{logger: l}).
 		StartConsume(ctx)
+	if err != nil {
+		l.Error("consumer stopped with error", "error", err)
+		os.Exit(1)
+	}
 
 }
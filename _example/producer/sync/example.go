@@ -8,8 +8,8 @@ import (
 )
 
 func main() {
-	// init logger
-	logger.Init()
+	// logger is injected into the producer, it's writing to stdout when TESSARA_ENABLE_LOG is true
+	l := logger.Default()
 
 	brokers := []string{"host.docker.internal:9092"}
 	topic := "example-topic"
@@ -17,9 +17,14 @@ func main() {
 	cfgProducer := tessara.NewProducerConfig(brokers).
 		WithSASL("kafkaUser", "kafkaPassword").
 		WithRetry(5).
-		WithTimeout(3 * time.Second)
+		WithTimeout(3 * time.Second).
+		WithLogger(l)
 
-	sp := tessara.NewSyncProducer(cfgProducer)
+	sp, err := tessara.NewSyncProducer(cfgProducer)
+	if err != nil {
+		l.Error("unable to create sync producer", "error", err)
+		return
+	}
 	defer sp.Producer.Close()
 
 	msg := tessara.ProducerMessage{
@@ -27,9 +32,9 @@ func main() {
 		Key:   "key",
 		Value: []byte("message-1"),
 	}
-	_, _, err := sp.Produce(msg)
+	_, _, err = sp.Produce(msg)
 	if err != nil {
-		logger.Debug().Err(err).Msg("unable to produce message")
+		l.Error("unable to produce message", "error", err)
 	}
 
 }
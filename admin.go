@@ -0,0 +1,208 @@
+package tessara
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrbryside/tessara/logger"
+)
+
+// errClaimNotFound is returned when the partition is not claimed by the consumer
+var errClaimNotFound = errors.New("partition is not claimed by the consumer")
+
+// claimSnapshot represents the runtime state of a claimed partition
+type claimSnapshot struct {
+	Topic        string               `json:"topic"`
+	Partition    int32                `json:"partition"`
+	Paused       bool                 `json:"paused"`
+	MemoryBuffer memoryBufferSnapshot `json:"memoryBuffer"`
+	Subqueues    []subqueueSnapshot   `json:"subqueues"`
+	Committer    committerSnapshot    `json:"committer"`
+}
+
+// memoryBufferSnapshot represents the state of the memory buffer and the message that is blocking the water mark
+type memoryBufferSnapshot struct {
+	Size            uint64          `json:"size"`
+	CurrentBuffer   uint64          `json:"currentBuffer"`
+	WaterMark       uint64          `json:"waterMark"`
+	WaterMarkOffset int64           `json:"waterMarkOffset"`
+	Blocking        *messageSummary `json:"blocking,omitempty"`
+}
+
+// subqueueSnapshot represents the channel depth of the subqueue and the message in flight
+type subqueueSnapshot struct {
+	ID              int             `json:"id"`
+	ChannelDepth    int             `json:"channelDepth"`
+	ChannelCapacity int             `json:"channelCapacity"`
+	InFlight        *messageSummary `json:"inFlight,omitempty"`
+}
+
+// committerSnapshot represents the commit position and timestamps of the committer
+type committerSnapshot struct {
+	LatestCommittedOffset int64     `json:"latestCommittedOffset"`
+	LastCommittedAt       time.Time `json:"lastCommittedAt"`
+	ClaimedAt             time.Time `json:"claimedAt"`
+}
+
+// messageSummary represents the message that is blocking the water mark or in flight, size is the number of messages of the batch
+type messageSummary struct {
+	Offset int64  `json:"offset"`
+	Key    string `json:"key"`
+	Size   int    `json:"size,omitempty"`
+	For    string `json:"for"`
+}
+
+// snapshot returns the runtime state of the claimed partition
+func (c *claimState) snapshot(tp topicPartition) claimSnapshot {
+	mb := c.committer.memoryBuffer
+	s := claimSnapshot{
+		Topic:     tp.topic,
+		Partition: tp.partition,
+		Paused:    c.paused,
+		MemoryBuffer: memoryBufferSnapshot{
+			Size:            mb.bufferSize,
+			CurrentBuffer:   mb.CurrentBuffer(),
+			WaterMark:       mb.WaterMark(),
+			WaterMarkOffset: mb.WaterMarkOffset(),
+		},
+		Committer: committerSnapshot{
+			LatestCommittedOffset: c.committer.latestCommittedOffset.Load(),
+			LastCommittedAt:       c.committer.lastCommittedAt(),
+			ClaimedAt:             c.committer.claimedAt,
+		},
+	}
+	if msb, blockingFor, ok := mb.BlockingMessage(); ok {
+		s.MemoryBuffer.Blocking = &messageSummary{Offset: msb.Offset(), Key: msb.key, For: blockingFor.String()}
+	}
+	for _, sq := range c.subqueues {
+		sqs := subqueueSnapshot{
+			ID:              sq.id,
+			ChannelDepth:    len(sq.receiver),
+			ChannelCapacity: cap(sq.receiver),
+		}
+		if m := sq.inFlight.Load(); m != nil {
+			sqs.InFlight = &messageSummary{Offset: m.offset, Key: m.key, Size: m.size, For: time.Since(m.startedAt).String()}
+		}
+		s.Subqueues = append(s.Subqueues, sqs)
+	}
+	return s
+}
+
+// claimSnapshots returns the runtime state of every claimed partition ordered by topic and partition
+func (hs *healthState) claimSnapshots() []claimSnapshot {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	snapshots := make([]claimSnapshot, 0, len(hs.claims))
+	for tp, c := range hs.claims {
+		snapshots = append(snapshots, c.snapshot(tp))
+	}
+	slices.SortFunc(snapshots, func(a, b claimSnapshot) int {
+		if n := strings.Compare(a.Topic, b.Topic); n != 0 {
+			return n
+		}
+		return int(a.Partition - b.Partition)
+	})
+	return snapshots
+}
+
+// setPaused pauses or resumes fetching of the claimed partition, messages that are already in the pipeline are still handled
+func (hs *healthState) setPaused(topic string, partition int32, paused bool) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	c, ok := hs.claims[topicPartition{topic: topic, partition: partition}]
+	if !ok {
+		return errClaimNotFound
+	}
+	if hs.consumerGroup == nil {
+		return errors.New("consumer is not started")
+	}
+	partitions := map[string][]int32{topic: {partition}}
+	if paused {
+		hs.consumerGroup.Pause(partitions)
+	} else {
+		hs.consumerGroup.Resume(partitions)
+	}
+	c.paused = paused
+	return nil
+}
+
+// forceCommit requests the committer of the claimed partition to commit the current water mark immediately
+func (hs *healthState) forceCommit(topic string, partition int32) error {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	c, ok := hs.claims[topicPartition{topic: topic, partition: partition}]
+	if !ok {
+		return errClaimNotFound
+	}
+	c.committer.ForceCommit()
+	return nil
+}
+
+// adminHandler creates the http handler of the runtime introspection and control endpoints, routes are
+//
+//	GET  /claims                               runtime state of every claimed partition
+//	POST /claims/{topic}/{partition}/pause     pause fetching of the partition
+//	POST /claims/{topic}/{partition}/resume    resume fetching of the partition
+//	POST /claims/{topic}/{partition}/commit    commit the current water mark of the partition
+//	GET  /log-level                            current log level
+//	PUT  /log-level?level=debug|info|warn|error change the log level
+func adminHandler(hs *healthState, lv *logger.LevelVar) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /claims", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, hs.claimSnapshots())
+	})
+	claimAction := func(action func(topic string, partition int32) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			partition, err := strconv.ParseInt(r.PathValue("partition"), 10, 32)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid partition: %v", err)})
+				return
+			}
+			if err := action(r.PathValue("topic"), int32(partition)); err != nil {
+				status := http.StatusConflict
+				if errors.Is(err, errClaimNotFound) {
+					status = http.StatusNotFound
+				}
+				writeJSON(w, status, map[string]string{"error": err.Error()})
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}
+	mux.HandleFunc("POST /claims/{topic}/{partition}/pause", claimAction(func(topic string, partition int32) error {
+		return hs.setPaused(topic, partition, true)
+	}))
+	mux.HandleFunc("POST /claims/{topic}/{partition}/resume", claimAction(func(topic string, partition int32) error {
+		return hs.setPaused(topic, partition, false)
+	}))
+	mux.HandleFunc("POST /claims/{topic}/{partition}/commit", claimAction(hs.forceCommit))
+	mux.HandleFunc("GET /log-level", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"level": lv.Level().String()})
+	})
+	mux.HandleFunc("PUT /log-level", func(w http.ResponseWriter, r *http.Request) {
+		level, err := logger.ParseLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		lv.Set(level)
+		writeJSON(w, http.StatusOK, map[string]string{"level": level.String()})
+	})
+	return mux
+}
+
+// writeJSON writes the value as JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
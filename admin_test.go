@@ -0,0 +1,61 @@
+package tessara
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mrbryside/tessara/logger"
+	"github.com/mrbryside/tessara/metric"
+)
+
+func TestAdminClaimsShowsMessageBlockingWaterMark(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mb := newMemoryBuffer(ctx, 4, time.Millisecond, time.Millisecond, metric.Discard())
+	done := newMessageBuffer(10)
+	done.MarkSuccess()
+	mb.Push(ctx, done)
+	mb.Push(ctx, newMessageBuffer(11).withKey([]byte("order-1")))
+	assert.Eventually(t, func() bool { return mb.WaterMarkOffset() == 10 }, time.Second, time.Millisecond)
+
+	hs := newHealthState(time.Minute)
+	hs.addClaim("orders", 0, &claimState{committer: &committer{memoryBuffer: mb}, subqueues: []*subqueue{{id: 1, receiver: make(chan subqueueMessage, 4)}}})
+
+	rec := httptest.NewRecorder()
+	adminHandler(hs, &logger.LevelVar{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/claims", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var claims []claimSnapshot
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &claims))
+	assert.Len(t, claims, 1)
+	assert.Equal(t, uint64(2), claims[0].MemoryBuffer.CurrentBuffer)
+	assert.Equal(t, uint64(1), claims[0].MemoryBuffer.WaterMark)
+	assert.Equal(t, int64(11), claims[0].MemoryBuffer.Blocking.Offset)
+	assert.Equal(t, "order-1", claims[0].MemoryBuffer.Blocking.Key)
+	assert.Equal(t, 4, claims[0].Subqueues[0].ChannelCapacity)
+}
+
+func TestAdminControlActions(t *testing.T) {
+	lv := &logger.LevelVar{}
+	handler := adminHandler(newHealthState(time.Minute), lv)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/claims/orders/0/commit", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log-level?level=warn", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, logger.LevelWarn, lv.Level())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log-level?level=verbose", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,115 @@
+package tessara
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrDecode is wrapped by the error of the message that is unable to be decoded by the codec of the typed consumer,
+	// it's permanent so the message goes straight to the dead letter topic or fallback without retry.
+	ErrDecode = errors.New("unable to decode message")
+	// ErrEncode is wrapped by the error of the message that is unable to be encoded by the codec of the typed producer.
+	ErrEncode = errors.New("unable to encode message")
+)
+
+// Codec encodes values of type T into message values and decodes message values back into values of type T.
+type Codec[T any] interface {
+	Encode(T) ([]byte, error)
+	Decode([]byte) (T, error)
+}
+
+// contextCodec is an optional interface of the codec that calls out while encoding or decoding e.g. to the schema registry,
+// typed consumer and producer use it so the call is cancelled with the message or produce context
+type contextCodec[T any] interface {
+	EncodeContext(context.Context, T) ([]byte, error)
+	DecodeContext(context.Context, []byte) (T, error)
+}
+
+// encodeContext encodes the value with the context if the codec is implementing EncodeContext
+func encodeContext[T any](ctx context.Context, codec Codec[T], v T) ([]byte, error) {
+	if cc, ok := codec.(contextCodec[T]); ok {
+		return cc.EncodeContext(ctx, v)
+	}
+	return codec.Encode(v)
+}
+
+// decodeContext decodes the data with the context if the codec is implementing DecodeContext
+func decodeContext[T any](ctx context.Context, codec Codec[T], data []byte) (T, error) {
+	if cc, ok := codec.(contextCodec[T]); ok {
+		return cc.DecodeContext(ctx, data)
+	}
+	return codec.Decode(data)
+}
+
+// jsonCodec encodes values with encoding/json.
+type jsonCodec[T any] struct{}
+
+// NewJSONCodec creates the codec that encodes values as JSON.
+func NewJSONCodec[T any]() jsonCodec[T] {
+	return jsonCodec[T]{}
+}
+
+// Encode encodes the value as JSON.
+func (jsonCodec[T]) Encode(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Decode decodes the JSON into a value.
+func (jsonCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// messagePackCodec encodes values with MessagePack.
+type messagePackCodec[T any] struct{}
+
+// NewMessagePackCodec creates the codec that encodes values as MessagePack, fields are named by msgpack struct tags.
+func NewMessagePackCodec[T any]() messagePackCodec[T] {
+	return messagePackCodec[T]{}
+}
+
+// Encode encodes the value as MessagePack.
+func (messagePackCodec[T]) Encode(v T) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Decode decodes the MessagePack into a value.
+func (messagePackCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := msgpack.Unmarshal(data, &v)
+	return v, err
+}
+
+// protobufCodec encodes generated protobuf messages with the protobuf wire format.
+type protobufCodec[T proto.Message] struct{}
+
+// NewProtobufCodec creates the codec that encodes protobuf messages with the wire format, T is the pointer of the generated message e.g. *pb.Order.
+func NewProtobufCodec[T proto.Message]() protobufCodec[T] {
+	return protobufCodec[T]{}
+}
+
+// Encode encodes the protobuf message.
+func (protobufCodec[T]) Encode(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+// Decode decodes the wire format into a new protobuf message.
+func (protobufCodec[T]) Decode(data []byte) (T, error) {
+	var zero T
+	// type of the generated message is available from its nil pointer
+	v, ok := zero.ProtoReflect().Type().New().Interface().(T)
+	if !ok {
+		return zero, fmt.Errorf("protobuf message type %T is not supported", zero)
+	}
+	if err := proto.Unmarshal(data, v); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
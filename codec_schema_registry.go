@@ -0,0 +1,246 @@
+package tessara
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// wireFormatMagicByte is the first byte of the Confluent wire format, it's followed by 4 bytes of the schema id
+const wireFormatMagicByte = 0
+
+// wireFormatHeaderSize is the size of the magic byte and the schema id
+const wireFormatHeaderSize = 5
+
+// ErrWireFormat is wrapped by the error of the message value that is not in the Confluent wire format.
+var ErrWireFormat = errors.New("invalid wire format")
+
+// schemaSerde serializes values of type T by the schema, values are deserialized by the schema they're written with.
+type schemaSerde[T any] interface {
+	serialize(T) ([]byte, error)
+	deserialize(writer Schema, data []byte) (T, error)
+}
+
+// schemaRegistryCodec encodes values in the Confluent wire format, schema is registered to the subject on the first encode
+// after it's checked for compatibility with the latest schema of the subject.
+type schemaRegistryCodec[T any] struct {
+	registry     SchemaRegistry
+	subject      string
+	schema       Schema
+	serde        schemaSerde[T]
+	autoRegister bool
+
+	// id is the schema id that is resolved on the first encode, it's shared by the copies of the codec
+	id *schemaIDOnce
+}
+
+// schemaIDOnce resolves the schema id once, it's resolved again on the next call when resolving is failed.
+type schemaIDOnce struct {
+	mu sync.Mutex
+	id int
+}
+
+// NewAvroSchemaCodec creates the codec of the Confluent wire format with the avro schema, T is encoded by avro struct tags.
+// messages written with older schemas of the subject are resolved to the schema when they're decoded.
+func NewAvroSchemaCodec[T any](registry SchemaRegistry, subject string, schema string) (schemaRegistryCodec[T], error) {
+	reader, err := parseAvroSchema(schema)
+	if err != nil {
+		return schemaRegistryCodec[T]{}, fmt.Errorf("invalid avro schema: %w", err)
+	}
+	return newSchemaRegistryCodec[T](registry, subject, Schema{Type: SchemaTypeAvro, Schema: schema}, &avroSerde[T]{reader: reader}), nil
+}
+
+// NewProtobufSchemaCodec creates the codec of the Confluent wire format with the protobuf schema, schema is the .proto definition of T
+// and T must be the first message of the definition, other message types of the schema are not supported when encoding.
+func NewProtobufSchemaCodec[T proto.Message](registry SchemaRegistry, subject string, schema string) schemaRegistryCodec[T] {
+	return newSchemaRegistryCodec[T](registry, subject, Schema{Type: SchemaTypeProtobuf, Schema: schema}, protobufSerde[T]{})
+}
+
+// NewJSONSchemaCodec creates the codec of the Confluent wire format with the JSON schema, T is encoded as JSON.
+func NewJSONSchemaCodec[T any](registry SchemaRegistry, subject string, schema string) schemaRegistryCodec[T] {
+	return newSchemaRegistryCodec[T](registry, subject, Schema{Type: SchemaTypeJSON, Schema: schema}, jsonSerde[T]{})
+}
+
+// newSchemaRegistryCodec creates the codec of the Confluent wire format, schema is registered on the first encode by default.
+func newSchemaRegistryCodec[T any](registry SchemaRegistry, subject string, schema Schema, serde schemaSerde[T]) schemaRegistryCodec[T] {
+	return schemaRegistryCodec[T]{
+		registry:     registry,
+		subject:      subject,
+		schema:       schema,
+		serde:        serde,
+		autoRegister: true,
+		id:           &schemaIDOnce{},
+	}
+}
+
+// WithoutAutoRegister makes the codec look up the id of the schema instead of registering it,
+// encoding fails when the schema is not registered to the subject.
+func (c schemaRegistryCodec[T]) WithoutAutoRegister() schemaRegistryCodec[T] {
+	c.autoRegister = false
+	c.id = &schemaIDOnce{}
+	return c
+}
+
+// Encode encodes the value with the magic byte and the schema id.
+func (c schemaRegistryCodec[T]) Encode(v T) ([]byte, error) {
+	return c.EncodeContext(context.Background(), v)
+}
+
+// EncodeContext encodes the value with the magic byte and the schema id, schema registry is called with the context.
+func (c schemaRegistryCodec[T]) EncodeContext(ctx context.Context, v T) ([]byte, error) {
+	id, err := c.schemaID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := c.serde.serialize(v)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, wireFormatHeaderSize, wireFormatHeaderSize+len(payload))
+	data[0] = wireFormatMagicByte
+	binary.BigEndian.PutUint32(data[1:], uint32(id))
+	return append(data, payload...), nil
+}
+
+// Decode decodes the value by the schema of the schema id in the message.
+func (c schemaRegistryCodec[T]) Decode(data []byte) (T, error) {
+	return c.DecodeContext(context.Background(), data)
+}
+
+// DecodeContext decodes the value by the schema of the schema id in the message, schema registry is called with the context.
+func (c schemaRegistryCodec[T]) DecodeContext(ctx context.Context, data []byte) (T, error) {
+	var zero T
+	if len(data) < wireFormatHeaderSize || data[0] != wireFormatMagicByte {
+		return zero, ErrWireFormat
+	}
+	writer, err := c.registry.SchemaByID(ctx, int(binary.BigEndian.Uint32(data[1:wireFormatHeaderSize])))
+	if err != nil {
+		return zero, err
+	}
+	if writer.Type != c.schema.Type {
+		return zero, fmt.Errorf("%w: message is written with %s schema", ErrWireFormat, writer.Type)
+	}
+	return c.serde.deserialize(writer, data[wireFormatHeaderSize:])
+}
+
+// schemaID returns the id of the schema, schema is checked for compatibility then registered when auto register is enabled.
+func (c schemaRegistryCodec[T]) schemaID(ctx context.Context) (int, error) {
+	c.id.mu.Lock()
+	defer c.id.mu.Unlock()
+	if c.id.id != 0 {
+		return c.id.id, nil
+	}
+
+	var id int
+	var err error
+	if c.autoRegister {
+		id, err = c.register(ctx)
+	} else {
+		id, err = c.registry.LookupID(ctx, c.subject, c.schema)
+	}
+	if err != nil {
+		return 0, err
+	}
+	c.id.id = id
+	return id, nil
+}
+
+// register checks the schema for compatibility with the latest schema of the subject then registers it.
+func (c schemaRegistryCodec[T]) register(ctx context.Context) (int, error) {
+	compatible, err := c.registry.IsCompatible(ctx, c.subject, c.schema)
+	if err != nil {
+		return 0, err
+	}
+	if !compatible {
+		return 0, fmt.Errorf("%w: subject %s", ErrIncompatibleSchema, c.subject)
+	}
+	return c.registry.Register(ctx, c.subject, c.schema)
+}
+
+// avroSerde serializes values with the avro schema, schemas that messages are written with are resolved to the reader schema.
+type avroSerde[T any] struct {
+	reader avro.Schema
+	// resolved caches the schema resolved from the writer schema to the reader schema by the writer schema
+	resolved sync.Map
+}
+
+// serialize serializes the value with the reader schema.
+func (s *avroSerde[T]) serialize(v T) ([]byte, error) {
+	return avro.Marshal(s.reader, v)
+}
+
+// deserialize deserializes the data written with the writer schema into the value of the reader schema.
+func (s *avroSerde[T]) deserialize(writer Schema, data []byte) (T, error) {
+	var v T
+	schema, err := s.resolve(writer.Schema)
+	if err != nil {
+		return v, err
+	}
+	err = avro.Unmarshal(schema, data, &v)
+	return v, err
+}
+
+// resolve returns the schema that reads data of the writer schema into the reader schema.
+func (s *avroSerde[T]) resolve(writer string) (avro.Schema, error) {
+	if schema, ok := s.resolved.Load(writer); ok {
+		return schema.(avro.Schema), nil
+	}
+	ws, err := parseAvroSchema(writer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid writer avro schema: %w", err)
+	}
+	schema := ws
+	if ws.Fingerprint() != s.reader.Fingerprint() {
+		if schema, err = avro.NewSchemaCompatibility().Resolve(s.reader, ws); err != nil {
+			return nil, fmt.Errorf("unable to resolve writer avro schema: %w", err)
+		}
+	}
+	s.resolved.Store(writer, schema)
+	return schema, nil
+}
+
+// protobufSerde serializes protobuf messages with the message indexes of the Confluent wire format.
+// only the first message type of the schema (message index 0) is supported when encoding, index is always written as 0
+// so T must be the first message of the .proto definition, other message types would be read as the first one by other clients.
+type protobufSerde[T proto.Message] struct{}
+
+// serialize serializes the message as the first message of the schema, index of the first message is written as a single 0.
+func (protobufSerde[T]) serialize(v T) ([]byte, error) {
+	return proto.MarshalOptions{}.MarshalAppend([]byte{0}, v)
+}
+
+// deserialize skips the message indexes then deserializes the message.
+func (protobufSerde[T]) deserialize(_ Schema, data []byte) (T, error) {
+	var zero T
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 {
+		return zero, fmt.Errorf("%w: invalid protobuf message indexes", ErrWireFormat)
+	}
+	data = data[n:]
+	for range count {
+		if _, n = binary.Varint(data); n <= 0 {
+			return zero, fmt.Errorf("%w: invalid protobuf message indexes", ErrWireFormat)
+		}
+		data = data[n:]
+	}
+	return NewProtobufCodec[T]().Decode(data)
+}
+
+// jsonSerde serializes values as JSON.
+type jsonSerde[T any] struct{}
+
+// serialize serializes the value as JSON.
+func (jsonSerde[T]) serialize(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// deserialize deserializes the JSON into the value.
+func (jsonSerde[T]) deserialize(_ Schema, data []byte) (T, error) {
+	return NewJSONCodec[T]().Decode(data)
+}
@@ -0,0 +1,82 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/mrbryside/tessara/logger"
+)
+
+type order struct {
+	ID     string `json:"id" msgpack:"id"`
+	Amount int    `json:"amount" msgpack:"amount"`
+}
+
+// orderHandler records the orders that are performed and the errors that are given to fallback
+type orderHandler struct {
+	orders      []order
+	fallbackErr error
+}
+
+func (h *orderHandler) Perform(_ context.Context, tm TypedMessage[order]) error {
+	h.orders = append(h.orders, tm.Value)
+	return nil
+}
+
+func (h *orderHandler) Fallback(_ context.Context, _ PerformMessage, err error) {
+	h.fallbackErr = err
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	o := order{ID: "order-1", Amount: 100}
+	for name, codec := range map[string]Codec[order]{"json": NewJSONCodec[order](), "msgpack": NewMessagePackCodec[order]()} {
+		data, err := codec.Encode(o)
+		assert.NoError(t, err, name)
+		decoded, err := codec.Decode(data)
+		assert.NoError(t, err, name)
+		assert.Equal(t, o, decoded, name)
+	}
+
+	pc := NewProtobufCodec[*wrapperspb.StringValue]()
+	data, err := pc.Encode(wrapperspb.String("order-1"))
+	assert.NoError(t, err)
+	decoded, err := pc.Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "order-1", decoded.GetValue())
+}
+
+func TestTypedHandlerRoutesDecodeErrorToFallback(t *testing.T) {
+	h := &orderHandler{}
+	rh := newRetryableHandler(typedHandlerAdapter[order]{codec: NewJSONCodec[order](), typedMessageHandler: h}, NewExponentialRetryPolicy(3, 0, 1), 0)
+
+	assert.NoError(t, rh.Perform(context.Background(), PerformMessage{Value: []byte(`{"id":"order-1","amount":100}`)}))
+	assert.Equal(t, []order{{ID: "order-1", Amount: 100}}, h.orders)
+
+	err := rh.Perform(context.Background(), PerformMessage{Value: []byte("not json")})
+	assert.ErrorIs(t, err, ErrDecode)
+	assert.True(t, isPermanentError(err))
+	rh.Fallback(context.Background(), PerformMessage{}, err)
+	assert.ErrorIs(t, h.fallbackErr, ErrDecode)
+}
+
+func TestTypedProducerEncodesValue(t *testing.T) {
+	mp := mocks.NewSyncProducer(t, nil)
+	mp.ExpectSendMessageWithCheckerFunctionAndSucceed(func(val []byte) error {
+		if string(val) != `{"id":"order-1","amount":100}` {
+			return errors.New("unexpected value " + string(val))
+		}
+		return nil
+	})
+	tp := &typedProducer[order]{producer: &syncProducer{Producer: mp, logger: logger.Default()}, codec: NewJSONCodec[order]()}
+
+	_, _, err := tp.Produce(TypedProducerMessage[order]{Topic: "orders", Key: "order-1", Value: order{ID: "order-1", Amount: 100}})
+	assert.NoError(t, err)
+
+	_, _, err = (&typedProducer[chan int]{codec: NewJSONCodec[chan int]()}).Produce(TypedProducerMessage[chan int]{Topic: "orders"})
+	assert.ErrorIs(t, err, ErrEncode)
+}
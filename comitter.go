@@ -2,18 +2,23 @@ package tessara
 
 import (
 	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/IBM/sarama"
 	"github.com/mrbryside/tessara/logger"
+	"github.com/mrbryside/tessara/metric"
 )
 
 // committer is a struct that implements the sarama.ConsumerGroupHandler interface
 type committer struct {
 	// error handler
 	errorHandler errorHandler
+	logger       logger.Logger
+	metrics      metric.PartitionMetrics
 
 	// memory buffer
 	memoryBuffer *memoryBuffer
@@ -27,9 +32,21 @@ type committer struct {
 	commitGiveupInterval        time.Duration
 	commitGiveUpTime            time.Duration
 	commitGiveUpErrorChan       chan error
-	latestCommittedOffset       int64
-	lastestCommittedAt          time.Time
+	latestCommittedOffset       atomic.Int64
+	lastestCommittedAt          atomic.Int64 // unix nano, it's read by health check
 	pushMessageBlockingInterval time.Duration
+
+	// transaction commits the water mark with the outputs of the transform message handler instead of marking offset to the session,
+	// it's only set for the transform consumer
+	transaction *transactionalProducer
+	groupID     string
+
+	// claimedAt is the time the committer is created, forceCommitChan receives the request to commit the current water mark immediately
+	claimedAt       time.Time
+	forceCommitChan chan struct{}
+
+	// done is closed once the committer is stopped by the context
+	done chan struct{}
 }
 
 // newCommitter creates a new Committer instance
@@ -37,6 +54,8 @@ func newCommitter(
 	ctx context.Context,
 	commitGiveUpErrorChan chan error,
 	errorHandler errorHandler,
+	l logger.Logger,
+	pm metric.PartitionMetrics,
 	mb *memoryBuffer,
 	session sarama.ConsumerGroupSession,
 	claim sarama.ConsumerGroupClaim,
@@ -44,22 +63,32 @@ func newCommitter(
 	commitGiveupInterval time.Duration,
 	commitGiveUpTime time.Duration,
 	pushMessageBlockingInterval time.Duration,
+	transaction *transactionalProducer,
+	groupID string,
 ) *committer {
 	c := &committer{
 		commitGiveUpErrorChan:       commitGiveUpErrorChan,
 		errorHandler:                errorHandler,
+		logger:                      l,
+		metrics:                     pm,
 		session:                     session,
 		claim:                       claim,
 		memoryBuffer:                mb,
 		commitInterval:              commitInterval,
 		commitGiveupInterval:        commitGiveupInterval,
 		commitGiveUpTime:            commitGiveUpTime,
-		latestCommittedOffset:       -1,
-		lastestCommittedAt:          time.Now(),
 		pushMessageBlockingInterval: pushMessageBlockingInterval,
+		claimedAt:                   time.Now(),
+		forceCommitChan:             make(chan struct{}, 1),
+		done:                        make(chan struct{}),
+		transaction:                 transaction,
+		groupID:                     groupID,
 	}
+	c.latestCommittedOffset.Store(-1)
+	c.lastestCommittedAt.Store(c.claimedAt.UnixNano())
 
 	go func() {
+		defer close(c.done)
 		c.startCommitIntervalAndCommitGiveUpInterval(ctx)
 	}()
 
@@ -80,35 +109,150 @@ func (c *committer) startCommitIntervalAndCommitGiveUpInterval(ctx context.Conte
 			return
 
 		case <-tickerCommitInterval.C:
-			waterMarkOffset := c.memoryBuffer.WaterMarkOffset()
-			waterMarkOffsetForCommit := waterMarkOffset + 1 // mark offset in kafka needs to be incremented by 1
-			if isWaterMarkOffsetNotDefault(waterMarkOffset) && isWaterMarkOffsetMoreThanLatestComittedOffset(waterMarkOffset, c.latestCommittedOffset) {
-				c.session.MarkOffset(c.claim.Topic(), c.claim.Partition(), waterMarkOffsetForCommit, "")
-				c.latestCommittedOffset = waterMarkOffset
-				c.lastestCommittedAt = time.Now()
-				logger.Debug().
-					Str("topic", c.claim.Topic()).
-					Int32("partition", c.claim.Partition()).
-					Int64("offset", waterMarkOffsetForCommit).
-					Msg("offset committed")
+			if c.transaction != nil {
+				c.commitWaterMarkTransaction(ctx)
+				continue
+			}
+			c.markWaterMarkOffset()
+
+		case <-c.forceCommitChan:
+			if c.transaction != nil {
+				c.commitWaterMarkTransaction(ctx)
+				continue
 			}
+			// mark then commit synchronously instead of waiting for sarama auto commit
+			c.markWaterMarkOffset()
+			c.session.Commit()
+			c.logger.Info("offset commit forced", "offset", c.latestCommittedOffset.Load()+1)
 
 		case <-tickerCommitGiveUpInterval.C:
-			if isCommitExceedGiveUpTime(c.lastestCommittedAt, c.commitGiveUpTime) && c.memoryBuffer.IsNeedToCommit() {
+			c.metrics.UpdateTimeSinceLastCommit(time.Since(c.lastCommittedAt()))
+			if c.isStalled() {
 				c.errorHandler.HandleCommitGiveUp(c.claim.Topic(), c.claim.Partition())
-				c.pushErrorToGiveUpErrorChannel(ctx)
+				c.pushErrorToGiveUpErrorChannel(ctx, errCommitGiveUp)
+			}
+		}
+	}
+}
+
+// markWaterMarkOffset marks the water mark offset of the memory buffer to the session if it's advanced since the latest commit
+func (c *committer) markWaterMarkOffset() {
+	waterMarkOffset := c.memoryBuffer.WaterMarkOffset()
+	waterMarkOffsetForCommit := waterMarkOffset + 1 // mark offset in kafka needs to be incremented by 1
+	if isWaterMarkOffsetNotDefault(waterMarkOffset) && isWaterMarkOffsetMoreThanLatestComittedOffset(waterMarkOffset, c.latestCommittedOffset.Load()) {
+		c.session.MarkOffset(c.claim.Topic(), c.claim.Partition(), waterMarkOffsetForCommit, "")
+		c.latestCommittedOffset.Store(waterMarkOffset)
+		c.lastestCommittedAt.Store(time.Now().UnixNano())
+		c.logger.Debug("offset committed", "offset", waterMarkOffsetForCommit)
+	}
+	c.updateOffsetMetrics(waterMarkOffset)
+}
+
+// commitWaterMarkTransaction produces the outputs of the message buffers between the released mark and the water mark
+// then commits them with the water mark offset in one transaction, message buffers are released once the transaction is committed.
+// transaction is aborted and retried on the next commit interval when it's abortable, claim is stopped when the producer is fenced or fatal
+func (c *committer) commitWaterMarkTransaction(ctx context.Context) {
+	// transaction is not started once the claim is ended, producer may be closing
+	if ctx.Err() != nil {
+		return
+	}
+	releasedMark, waterMark := c.memoryBuffer.ReleasedMark(), c.memoryBuffer.WaterMark()
+	if waterMark == releasedMark {
+		c.updateOffsetMetrics(c.latestCommittedOffset.Load())
+		return
+	}
+	// water mark offset is taken from the message buffer below the water mark, water mark offset of the memory buffer may be ahead of it
+	waterMarkOffset := c.memoryBuffer.MessageBufferAt(waterMark - 1).Offset()
+	waterMarkOffsetForCommit := waterMarkOffset + 1
+
+	if err := c.produceWaterMarkTransaction(releasedMark, waterMark, waterMarkOffsetForCommit); err != nil {
+		if errors.Is(err, ErrProducerFenced) || errors.Is(err, ErrTransactionFatal) {
+			c.logger.Error("unable to commit offset transaction, stopping the claim", "offset", waterMarkOffsetForCommit, "error", err)
+			c.handleTransactionError(ctx, err)
+			return
+		}
+		c.logger.Warn("offset transaction is failed, it's retried on next commit", "offset", waterMarkOffsetForCommit, "error", err)
+		if !c.transaction.isAbortable() {
+			return
+		}
+		if abortErr := c.transaction.AbortTxn(); abortErr != nil {
+			c.logger.Error("unable to abort offset transaction, stopping the claim", "offset", waterMarkOffsetForCommit, "error", abortErr)
+			c.handleTransactionError(ctx, abortErr)
+		}
+		return
+	}
+
+	c.memoryBuffer.Release(waterMark)
+	c.latestCommittedOffset.Store(waterMarkOffset)
+	c.lastestCommittedAt.Store(time.Now().UnixNano())
+	c.logger.Debug("offset committed with transaction", "offset", waterMarkOffsetForCommit, "messages", waterMark-releasedMark)
+	c.updateOffsetMetrics(waterMarkOffset)
+}
+
+// produceWaterMarkTransaction produces the outputs of the message buffers in order of the memory buffer
+// and adds the offset to the transaction of the consumer group
+func (c *committer) produceWaterMarkTransaction(releasedMark, waterMark uint64, offset int64) error {
+	if err := c.transaction.BeginTxn(); err != nil {
+		return err
+	}
+	for i := releasedMark; i < waterMark; i++ {
+		for _, output := range c.memoryBuffer.MessageBufferAt(i).Outputs() {
+			if _, _, err := c.transaction.Produce(output); err != nil {
+				return err
 			}
 		}
 	}
+	if err := c.transaction.AddOffsetToTxn(c.claim.Topic(), c.claim.Partition(), offset, c.groupID); err != nil {
+		return err
+	}
+	return c.transaction.CommitTxn()
+}
+
+// ForceCommit requests the committer to commit the current water mark immediately, request is dropped if one is already pending
+func (c *committer) ForceCommit() {
+	select {
+	case c.forceCommitChan <- struct{}{}:
+	default:
+	}
+}
+
+// updateOffsetMetrics updates the offset and lag metrics of the partition, committed offset falls back to the initial offset of the claim
+// until the first commit of the claim
+func (c *committer) updateOffsetMetrics(waterMarkOffset int64) {
+	committedOffset := c.claim.InitialOffset()
+	if latestCommittedOffset := c.latestCommittedOffset.Load(); latestCommittedOffset != -1 {
+		committedOffset = latestCommittedOffset + 1
+	}
+	c.metrics.UpdateOffsets(c.claim.HighWaterMarkOffset(), committedOffset, waterMarkOffset)
+	c.metrics.UpdateTimeSinceLastCommit(time.Since(c.lastCommittedAt()))
+}
+
+// lastCommittedAt returns the time of the latest commit, it's the time the committer is created until the first commit
+func (c *committer) lastCommittedAt() time.Time {
+	return time.Unix(0, c.lastestCommittedAt.Load())
+}
+
+// isStalled returns true if messages are waiting to be committed and commit has not advanced longer than commit give up time
+func (c *committer) isStalled() bool {
+	return isCommitExceedGiveUpTime(c.lastCommittedAt(), c.commitGiveUpTime) && c.memoryBuffer.IsNeedToCommit()
+}
+
+// handleTransactionError reports the transaction error that stops the claim to the error handler if it's implementing HandleTransactionError,
+// then pushes it to give up error channel so the claim is ended with it
+func (c *committer) handleTransactionError(ctx context.Context, err error) {
+	if teh, ok := c.errorHandler.(transactionErrorHandler); ok {
+		teh.HandleTransactionError(c.claim.Topic(), c.claim.Partition(), err)
+	}
+	c.pushErrorToGiveUpErrorChannel(ctx, fmt.Errorf("unable to commit offset transaction: %w", err))
 }
 
 // pushErrorToGiveUpErrorChannel pushes error to give up error channel
-func (c *committer) pushErrorToGiveUpErrorChannel(ctx context.Context) {
+func (c *committer) pushErrorToGiveUpErrorChannel(ctx context.Context, err error) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case c.commitGiveUpErrorChan <- errors.New("error commit give up"):
+		case c.commitGiveUpErrorChan <- err:
 			return
 		default:
 			time.Sleep(c.pushMessageBlockingInterval)
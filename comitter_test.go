@@ -0,0 +1,122 @@
+package tessara
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mrbryside/tessara/logger"
+	"github.com/mrbryside/tessara/metric"
+	"github.com/mrbryside/tessara/mock"
+)
+
+// offsetRecordingSyncProducer records the offsets that are added to the transaction
+type offsetRecordingSyncProducer struct {
+	*mocks.SyncProducer
+	offsets []int64
+	groupID string
+}
+
+func (p *offsetRecordingSyncProducer) AddOffsetsToTxn(offsets map[string][]*sarama.PartitionOffsetMetadata, groupID string) error {
+	for _, o := range offsets["orders"] {
+		p.offsets = append(p.offsets, o.Offset)
+	}
+	p.groupID = groupID
+	return nil
+}
+
+func TestCommitterCommitsOutputsWithWaterMarkInTransaction(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mp := mocks.NewSyncProducer(t, nil)
+	mp.ExpectSendMessageAndSucceed()
+	mp.ExpectSendMessageAndSucceed()
+	rp := &offsetRecordingSyncProducer{SyncProducer: mp}
+	mb := newMemoryBuffer(ctx, 2, time.Millisecond, time.Millisecond, metric.Discard()).withReleaseOnCommit()
+	c := &committer{
+		logger:       logger.Default(),
+		metrics:      metric.Discard(),
+		memoryBuffer: mb,
+		claim:        mock.ConsumerGroupClaim{TopicFunc: func() string { return "orders" }},
+		transaction:  &transactionalProducer{producer: syncProducer{Producer: rp, logger: logger.Default()}},
+		groupID:      "orders-group",
+	}
+	c.latestCommittedOffset.Store(-1)
+
+	for offset := int64(10); offset < 12; offset++ {
+		msgBuffer := newMessageBuffer(offset)
+		msgBuffer.setOutputs([]ProducerMessage{{Topic: "invoices", Key: "order"}})
+		mb.Push(ctx, msgBuffer)
+		msgBuffer.MarkSuccess()
+	}
+	assert.Eventually(t, func() bool { return mb.WaterMark() == 2 }, time.Second, time.Millisecond)
+	// message buffers are kept until they're committed even though the water mark is advanced
+	assert.False(t, mb.IsBufferAvailable())
+
+	c.commitWaterMarkTransaction(ctx)
+	assert.Equal(t, []int64{12}, rp.offsets)
+	assert.Equal(t, "orders-group", rp.groupID)
+	assert.Equal(t, sarama.ProducerTxnFlagReady, mp.TxnStatus())
+	assert.Equal(t, int64(11), c.latestCommittedOffset.Load())
+	assert.True(t, mb.IsBufferAvailable())
+
+	// nothing is committed when the water mark is not advanced
+	c.commitWaterMarkTransaction(ctx)
+	assert.Equal(t, []int64{12}, rp.offsets)
+}
+
+// transactionRecorderErrorHandler records the transaction errors reported to the error handler
+type transactionRecorderErrorHandler struct {
+	loggingErrorHandler
+	errs []error
+}
+
+func (eh *transactionRecorderErrorHandler) HandleTransactionError(topic string, partition int32, err error) {
+	eh.errs = append(eh.errs, err)
+}
+
+func TestCommitterStopsClaimWithFencedTransactionError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mp := mocks.NewSyncProducer(t, nil)
+	mp.ExpectSendMessageAndSucceed()
+	fp := failingTxnSyncProducer{SyncProducer: mp, commitErr: sarama.ErrProducerFenced, status: sarama.ProducerTxnFlagFatalError}
+	mb := newMemoryBuffer(ctx, 1, time.Millisecond, time.Millisecond, metric.Discard()).withReleaseOnCommit()
+	eh := &transactionRecorderErrorHandler{loggingErrorHandler: newLoggingErrorHandler(logger.Default())}
+	commitGiveUpErrorChan := make(chan error, 1)
+	c := &committer{
+		logger:                      logger.Default(),
+		metrics:                     metric.Discard(),
+		memoryBuffer:                mb,
+		errorHandler:                eh,
+		commitGiveUpErrorChan:       commitGiveUpErrorChan,
+		pushMessageBlockingInterval: time.Millisecond,
+		claim: mock.ConsumerGroupClaim{
+			TopicFunc:     func() string { return "orders" },
+			PartitionFunc: func() int32 { return 0 },
+		},
+		transaction: &transactionalProducer{producer: syncProducer{Producer: fp, logger: logger.Default()}},
+	}
+	c.latestCommittedOffset.Store(-1)
+
+	msgBuffer := newMessageBuffer(10)
+	msgBuffer.setOutputs([]ProducerMessage{{Topic: "invoices", Key: "order"}})
+	mb.Push(ctx, msgBuffer)
+	msgBuffer.MarkSuccess()
+	assert.Eventually(t, func() bool { return mb.WaterMark() == 1 }, time.Second, time.Millisecond)
+
+	c.commitWaterMarkTransaction(ctx)
+	err := <-commitGiveUpErrorChan
+	// fencing is told apart from the stalled commit
+	assert.ErrorIs(t, err, ErrProducerFenced)
+	assert.NotErrorIs(t, err, errCommitGiveUp)
+	assert.Len(t, eh.errs, 1)
+	assert.ErrorIs(t, eh.errs[0], ErrProducerFenced)
+	assert.Equal(t, int64(-1), c.latestCommittedOffset.Load())
+}
@@ -1,6 +1,9 @@
 package tessara
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 // ------ Consumer ------
 // sasl configures SASL authentication for the consumer.
@@ -15,6 +18,9 @@ type offsetInitialNewest struct{}
 // offsetInitialOldest configures the consumer to start consuming from the oldest offset.
 type offsetInitialOldest struct{}
 
+// isolationReadCommitted configures the consumer to skip records of aborted transactions.
+type isolationReadCommitted struct{}
+
 // ------ Producer -------
 // producerRetry configures the producer to retry sending messages.
 type producerRetry struct {
@@ -25,3 +31,61 @@ type producerRetry struct {
 type producerTimeout struct {
 	Duration time.Duration
 }
+
+// producerLinger configures how long the async producer waits to batch messages before sending them.
+type producerLinger struct {
+	Duration time.Duration
+}
+
+// producerBatchSize configures the number of messages that triggers sending a batch of the async producer.
+type producerBatchSize struct {
+	Messages int
+}
+
+// producerPartitioner configures the partitioner of the messages that are not produced to an explicit partition.
+type producerPartitioner struct {
+	Partitioner partitioner
+}
+
+// producerTransaction configures the producer to be transactional with the transactional id.
+type producerTransaction struct {
+	ID string
+}
+
+// validateSaramaConfig returns every problem of the sarama configs joined into one error.
+func validateSaramaConfig(saramaConfig []any) error {
+	var errs []error
+	for _, sc := range saramaConfig {
+		switch c := sc.(type) {
+		case sasl:
+			if c.Username == "" || c.Password == "" {
+				errs = append(errs, errors.New("username and password must not be empty"))
+			}
+		case producerRetry:
+			if c.Max < 0 {
+				errs = append(errs, errors.New("producer retry max must be greater than or equal to 0"))
+			}
+		case producerTimeout:
+			if c.Duration <= 0 {
+				errs = append(errs, errors.New("producer timeout must be greater than 0"))
+			}
+		case producerLinger:
+			if c.Duration < 0 {
+				errs = append(errs, errors.New("producer linger must be greater than or equal to 0"))
+			}
+		case producerTransaction:
+			if c.ID == "" {
+				errs = append(errs, errors.New("transactional id must not be empty"))
+			}
+		case producerPartitioner:
+			if c.Partitioner.constructor == nil {
+				errs = append(errs, errors.New("producer partitioner must not be nil"))
+			}
+		case producerBatchSize:
+			if c.Messages < 0 {
+				errs = append(errs, errors.New("producer batch size must be greater than or equal to 0"))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
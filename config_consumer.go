@@ -1,35 +1,53 @@
 package tessara
 
 import (
+	"errors"
+	"os"
+	"regexp"
+	"slices"
 	"time"
 
+	"github.com/cenkalti/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/mrbryside/tessara/logger"
 )
 
 // consumerConfig represents the configuration for a consumer and sarama config that will be transformed into a sarama config.
 type consumerConfig struct {
 	// kafka configuration
-	topic           string
 	consumerGroupID string
 	brokers         []string
 
-	// memory buffer config
-	bufferSize                      uint64
-	waterMarkUpdateBlockingInterval time.Duration
-	pushMessageBlockingInterval     time.Duration
+	// pipeline config of the topic given to NewConsumerConfig
+	topicConfig topicConfig
+
+	// retry policy of every topic that has no retry policy of its own
+	retryPolicy RetryPolicy
+
+	// topic pattern config
+	topicPattern         *regexp.Regexp
+	topicRefreshInterval time.Duration
+
+	// logger of the consumer pipeline
+	logger logger.Logger
 
-	// message handler config
-	maxRetry        int
-	retryMultiplier float64
+	// metrics config, metrics are not registered when registerer is not set
+	metricsRegisterer prometheus.Registerer
+	metricsNamespace  string
+	metricsBuckets    []float64
 
-	// subqueue config
-	subqueueNumber int
-	subqueueMode   string
+	// tracer provider of the consume pipeline spans and the retry and dead letter producer spans
+	tracerProvider trace.TracerProvider
 
-	// comitter config
-	commitInterval       time.Duration
-	commitGiveUpInterval time.Duration
-	commitGiveUpTime     time.Duration
+	// transactional id prefix of the transactional producers of the transform consumer, it's the consumer group id by default
+	transactionalIDPrefix string
+
+	// health config, consumer is unhealthy when any subqueue is full longer than saturation threshold
+	saturationThreshold time.Duration
 
 	// sarama config
 	saramaConfig []any
@@ -38,109 +56,169 @@ type consumerConfig struct {
 // NewConsumerConfig creates a new consumer configuration.
 func NewConsumerConfig(brokers []string, topic string, consumerGroupID string) consumerConfig {
 	c := consumerConfig{
-		topic:           topic,
 		consumerGroupID: consumerGroupID,
 		brokers:         brokers,
+		topicConfig:     NewTopicConfig(topic),
 	}
+	c.transactionalIDPrefix = consumerGroupID
 
 	// default config
-	c.bufferSize = 256
-	c.subqueueNumber = 1
-	c.subqueueMode = "key_distribute"
-	c.maxRetry = 0
-	c.retryMultiplier = 1.5 // this may no need right now because user using WithRetry to set that give both maxRetry and retryMultiplier
-	c.commitInterval = 3 * time.Second
-	c.commitGiveUpInterval = 10 * time.Second
-	c.commitGiveUpTime = 120 * time.Second
-	c.waterMarkUpdateBlockingInterval = 10 * time.Millisecond
-	c.pushMessageBlockingInterval = 10 * time.Millisecond
+	c.retryPolicy = NewExponentialRetryPolicy(0, backoff.DefaultInitialInterval, 1.5)
+	c.topicRefreshInterval = 1 * time.Minute
+	c.saturationThreshold = 1 * time.Minute
+	c.logger = logger.Default()
+	c.tracerProvider = otel.GetTracerProvider()
+	if os.Getenv("TESSARA_REGISTER_METRICS") == "true" {
+		c.metricsRegisterer = prometheus.DefaultRegisterer
+	}
 
 	return c
 }
 
 /*
-consumer configuration
+consumer configuration, config below is applied to the topic given to NewConsumerConfig.
 */
 
 // WithBufferSize sets the buffer size for the consumer. (default: 256)
 func (c consumerConfig) WithBufferSize(bufferSize uint64) consumerConfig {
-	if bufferSize <= 0 {
-		logger.Panic().Msg("buffer size must be greater than 0")
-	}
-	c.bufferSize = bufferSize
+	c.topicConfig = c.topicConfig.WithBufferSize(bufferSize)
 	return c
 }
 
 // WithRoundRobinMode sets the round robin mode for the consumer. (default: key_distribute)
 func (c consumerConfig) WithRoundRobinMode() consumerConfig {
-	c.subqueueMode = "round_robin"
+	c.topicConfig = c.topicConfig.WithRoundRobinMode()
 	return c
 }
 
 // WithKeyDistributeMode sets the key distribute mode for the consumer. (default: key_distribute)
 func (c consumerConfig) WithKeyDistributeMode() consumerConfig {
-	c.subqueueMode = "key_distribute"
+	c.topicConfig = c.topicConfig.WithKeyDistributeMode()
 	return c
 }
 
 // WithCommitGiveUpInterval sets the commit give up interval for the consumer. (default: 10 seconds)
 func (c consumerConfig) WithCommitGiveUpInterval(commitGiveUpInterval time.Duration) consumerConfig {
-	if commitGiveUpInterval <= 0 {
-		logger.Panic().Msg("commit give up interval must be greater than 0")
-	}
-	c.commitGiveUpInterval = commitGiveUpInterval
+	c.topicConfig = c.topicConfig.WithCommitGiveUpInterval(commitGiveUpInterval)
 	return c
 }
 
 // WithCommitGiveUpTime sets the commit give up time for the consumer. (default: 120 seconds)
 func (c consumerConfig) WithCommitGiveUpTime(commitGiveUpTime time.Duration) consumerConfig {
-	if commitGiveUpTime <= 0 {
-		logger.Panic().Msg("commit give up time must be greater than 0")
-	}
-	c.commitGiveUpTime = commitGiveUpTime
+	c.topicConfig = c.topicConfig.WithCommitGiveUpTime(commitGiveUpTime)
 	return c
 }
 
 // WithCommitInterval sets the commit interval for the consumer. (default: 3 seconds)
 func (c consumerConfig) WithCommitInterval(commitInterval time.Duration) consumerConfig {
-	if commitInterval <= 0 {
-		logger.Panic().Msg("commit interval must be greater than 0")
-	}
-	c.commitInterval = commitInterval
+	c.topicConfig = c.topicConfig.WithCommitInterval(commitInterval)
 	return c
 }
 
 // WithBlockingInterval sets the blocking interval that the consumer will wait before pushMessage, update watermark. (default: 10 millisecs)
 func (c consumerConfig) WithBlockingInterval(blockingInterval time.Duration) consumerConfig {
-	if blockingInterval <= 0 {
-		logger.Panic().Msg("blocking interval must be greater than 0")
-	}
-	c.waterMarkUpdateBlockingInterval = blockingInterval
-	c.pushMessageBlockingInterval = blockingInterval
-
+	c.topicConfig = c.topicConfig.WithBlockingInterval(blockingInterval)
 	return c
 }
 
-// WithRetry sets the retry configuration for the consumer. (default: max 3 times, multiplier: 1.5)
+// WithRetry sets the exponential retry configuration for every topic of the consumer that has no retry policy of its own. (default: no retry, multiplier: 1.5)
 func (c consumerConfig) WithRetry(maxRetry int, retryMultiplier float64) consumerConfig {
-	if maxRetry < 0 {
-		logger.Panic().Msg("max retry must be greater than or equal to 0")
-	}
-	if retryMultiplier <= 0 {
-		logger.Panic().Msg("retry multiplier must be greater than 0")
-	}
-	c.maxRetry = maxRetry
-	c.retryMultiplier = retryMultiplier
+	return c.WithRetryPolicy(NewExponentialRetryPolicy(maxRetry, backoff.DefaultInitialInterval, retryMultiplier))
+}
 
+// WithRetryPolicy sets the retry policy for every topic of the consumer that has no retry policy of its own. (default: no retry)
+func (c consumerConfig) WithRetryPolicy(retryPolicy RetryPolicy) consumerConfig {
+	c.retryPolicy = retryPolicy
 	return c
 }
 
 // WithSubqueue sets the subqueue number for the consumer. (default: 1)
 func (c consumerConfig) WithSubqueue(subqueueNumber int) consumerConfig {
-	if subqueueNumber <= 0 {
-		logger.Panic().Msg("subqueue number must be greater than 0")
+	c.topicConfig = c.topicConfig.WithSubqueue(subqueueNumber)
+	return c
+}
+
+// WithBatch sets the batch max size and batch max linger for the batch message handler of the consumer. (default: 100 messages, 100 millisecs)
+func (c consumerConfig) WithBatch(batchMaxSize int, batchMaxLinger time.Duration) consumerConfig {
+	c.topicConfig = c.topicConfig.WithBatch(batchMaxSize, batchMaxLinger)
+	return c
+}
+
+// WithHandlerTimeout sets the timeout of each perform attempt of the consumer. (default: no timeout)
+func (c consumerConfig) WithHandlerTimeout(handlerTimeout time.Duration) consumerConfig {
+	c.topicConfig = c.topicConfig.WithHandlerTimeout(handlerTimeout)
+	return c
+}
+
+// WithFailurePolicy sets what happens to the message after the fallback is called for the consumer. (default: block)
+func (c consumerConfig) WithFailurePolicy(failurePolicy FailurePolicy) consumerConfig {
+	c.topicConfig = c.topicConfig.WithFailurePolicy(failurePolicy)
+	return c
+}
+
+// WithDeadLetterTopic sets the dead letter topic for the consumer, message that run out of retries is published to the dead letter topic. (default: none)
+func (c consumerConfig) WithDeadLetterTopic(deadLetterTopic string) consumerConfig {
+	c.topicConfig = c.topicConfig.WithDeadLetterTopic(deadLetterTopic)
+	return c
+}
+
+// WithRetryTopics sets the retry topic tiers for the consumer, message that run out of retries is published to the next tier. (default: none)
+func (c consumerConfig) WithRetryTopics(delays ...time.Duration) consumerConfig {
+	c.topicConfig = c.topicConfig.WithRetryTopics(delays...)
+	return c
+}
+
+// WithTopicPattern subscribes the consumer to every topic in cluster metadata that matches the pattern, matched topics
+// use the pipeline config and message handler of the consumer. dead letter and retry topics of the consumer are never matched.
+// topic given to NewConsumerConfig can be empty in this mode. (default: none)
+func (c consumerConfig) WithTopicPattern(pattern *regexp.Regexp) consumerConfig {
+	c.topicPattern = pattern
+	return c
+}
+
+// WithTopicRefreshInterval sets the interval that the consumer will re-check cluster metadata for topics matching the pattern. (default: 1 minute)
+func (c consumerConfig) WithTopicRefreshInterval(topicRefreshInterval time.Duration) consumerConfig {
+	c.topicRefreshInterval = topicRefreshInterval
+	return c
+}
+
+// WithLogger sets the logger of the consumer, pipeline log lines include group, topic, partition, subqueue and offset fields,
+// nil logger falls back to the default. (default: zerolog to stdout enabled by TESSARA_ENABLE_LOG)
+func (c consumerConfig) WithLogger(l logger.Logger) consumerConfig {
+	if l == nil {
+		l = logger.Default()
 	}
-	c.subqueueNumber = subqueueNumber
+	c.logger = l
+	return c
+}
+
+// WithMetricsRegisterer sets the registerer and namespace of the consumer metrics, metrics are labelled with group, topic and partition
+// so several consumers can share one registerer. (default: prometheus.DefaultRegisterer without namespace if TESSARA_REGISTER_METRICS is true, otherwise none)
+func (c consumerConfig) WithMetricsRegisterer(reg prometheus.Registerer, namespace string) consumerConfig {
+	c.metricsRegisterer = reg
+	c.metricsNamespace = namespace
+	return c
+}
+
+// WithMetricsBuckets sets the buckets in seconds of the processing time and push to buffer waiting time histograms. (default: prometheus.DefBuckets)
+func (c consumerConfig) WithMetricsBuckets(buckets ...float64) consumerConfig {
+	c.metricsBuckets = buckets
+	return c
+}
+
+// WithTracerProvider sets the tracer provider of the consumer spans, trace context is extracted from the record headers
+// and injected into the retry and dead letter records, nil tracer provider falls back to the default. (default: otel global tracer provider)
+func (c consumerConfig) WithTracerProvider(tp trace.TracerProvider) consumerConfig {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	c.tracerProvider = tp
+	return c
+}
+
+// WithSaturationThreshold sets how long a subqueue can stay full before the consumer is reported as unhealthy. (default: 1 minute)
+func (c consumerConfig) WithSaturationThreshold(saturationThreshold time.Duration) consumerConfig {
+	c.saturationThreshold = saturationThreshold
 	return c
 }
 
@@ -152,9 +230,6 @@ sarama config functions, config below will transform to sarama configuration to
 
 // WithSASL sets the SASL configuration for the consumer. (default: none)
 func (c consumerConfig) WithSASL(username, password string) consumerConfig {
-	if username == "" || password == "" {
-		logger.Panic().Msg("username and password must not be empty")
-	}
 	c.saramaConfig = append(c.saramaConfig, sasl{
 		Username: username,
 		Password: password,
@@ -174,4 +249,65 @@ func (c consumerConfig) WithOffsetInitialOldest() consumerConfig {
 	return c
 }
 
+// WithIsolationReadCommitted sets the isolation level to read_committed so records of aborted transactions are skipped. (default: read_uncommitted)
+func (c consumerConfig) WithIsolationReadCommitted() consumerConfig {
+	c.saramaConfig = append(c.saramaConfig, isolationReadCommitted{})
+	return c
+}
+
+// WithTransactionalIDPrefix sets the prefix of the transactional ids of the transform consumer, every claimed partition has
+// its own transactional producer with id of prefix-topic-partition so the producer of the previous owner is fenced. (default: consumer group id)
+func (c consumerConfig) WithTransactionalIDPrefix(prefix string) consumerConfig {
+	c.transactionalIDPrefix = prefix
+	return c
+}
+
 //------------
+
+// Validate returns every problem of the consumer configuration joined into one error, it returns nil if the configuration is valid.
+func (c consumerConfig) Validate() error {
+	var errs []error
+	if len(c.brokers) == 0 {
+		errs = append(errs, errors.New("brokers must not be empty"))
+	}
+	if c.consumerGroupID == "" {
+		errs = append(errs, errors.New("consumer group id must not be empty"))
+	}
+	if c.topicConfig.topic == "" && c.topicPattern == nil {
+		errs = append(errs, errors.New("topic must not be empty when topic pattern is not set"))
+	}
+	if c.topicPattern != nil && len(c.topicConfig.retryTopicDelays) > 0 {
+		errs = append(errs, errors.New("retry topics are not supported with topic pattern"))
+	}
+	if c.topicRefreshInterval <= 0 {
+		errs = append(errs, errors.New("topic refresh interval must be greater than 0"))
+	}
+	if c.transactionalIDPrefix == "" {
+		errs = append(errs, errors.New("transactional id prefix must not be empty"))
+	}
+	if c.saturationThreshold <= 0 {
+		errs = append(errs, errors.New("saturation threshold must be greater than 0"))
+	}
+	if !slices.IsSorted(c.metricsBuckets) || len(slices.Compact(slices.Clone(c.metricsBuckets))) != len(c.metricsBuckets) {
+		errs = append(errs, errors.New("metrics buckets must be in increasing order"))
+	}
+	if err := c.retryPolicy.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.topicConfig.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, validateSaramaConfig(c.saramaConfig))
+	return errors.Join(errs...)
+}
+
+// toProducerConfig creates the producer config that is sharing brokers and authentication with the consumer.
+func (c consumerConfig) toProducerConfig() producerConfig {
+	pc := NewProducerConfig(c.brokers).WithLogger(c.logger).WithTracerProvider(c.tracerProvider)
+	for _, cc := range c.saramaConfig {
+		if s, ok := cc.(sasl); ok {
+			pc = pc.WithSASL(s.Username, s.Password)
+		}
+	}
+	return pc
+}
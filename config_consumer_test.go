@@ -0,0 +1,65 @@
+package tessara
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumerConfigValidateDefault(t *testing.T) {
+	cfg := NewConsumerConfig([]string{"localhost:9092"}, "orders", "orders-group")
+
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestConsumerConfigValidateCollectsEveryProblem(t *testing.T) {
+	cfg := NewConsumerConfig(nil, "orders", "orders-group").
+		WithTopicPattern(regexp.MustCompile("^orders")).
+		WithRetryTopics(5*time.Second).
+		WithBufferSize(0).
+		WithSubqueue(0).
+		WithRetryPolicy(NewExponentialRetryPolicy(-1, 500*time.Millisecond, 1.5)).
+		WithSASL("", "")
+
+	err := cfg.Validate()
+
+	assert.ErrorContains(t, err, "brokers must not be empty")
+	assert.ErrorContains(t, err, "retry topics are not supported with topic pattern")
+	assert.ErrorContains(t, err, "buffer size must be greater than 0")
+	assert.ErrorContains(t, err, "subqueue number must be greater than 0")
+	assert.ErrorContains(t, err, "max retry must be greater than or equal to 0")
+	assert.ErrorContains(t, err, "username and password must not be empty")
+}
+
+func TestConsumerValidateDuplicateTopic(t *testing.T) {
+	cfg := NewConsumerConfig([]string{"localhost:9092"}, "orders", "orders-group")
+
+	err := NewConsumer(cfg, messageBenchMarkHandler{}).
+		WithTopic(NewTopicConfig("orders").WithCommitInterval(0), messageBenchMarkHandler{}).
+		Validate()
+
+	assert.ErrorContains(t, err, "topic orders is already registered")
+	assert.ErrorContains(t, err, "commit interval must be greater than 0")
+}
+
+func TestConsumerWithNilLoggerFallsBackToDefault(t *testing.T) {
+	cfg := NewConsumerConfig([]string{"localhost:9092"}, "orders", "orders-group").WithLogger(nil)
+
+	assert.NotPanics(t, func() { NewConsumer(cfg, messageBenchMarkHandler{}) })
+	assert.NotNil(t, cfg.logger)
+	assert.NoError(t, cfg.Validate())
+	assert.NotNil(t, NewProducerConfig([]string{"localhost:9092"}).WithLogger(nil).logger)
+}
+
+func TestConsumerWithNilTracerProviderFallsBackToDefault(t *testing.T) {
+	cfg := NewConsumerConfig([]string{"localhost:9092"}, "orders", "orders-group").WithTracerProvider(nil)
+
+	assert.NotPanics(t, func() { NewConsumer(cfg, messageBenchMarkHandler{}) })
+	assert.NoError(t, cfg.Validate())
+
+	pc := NewProducerConfig([]string{"localhost:9092"}).WithTracerProvider(nil)
+	assert.NotNil(t, pc.tracerProvider)
+	assert.NoError(t, pc.Validate())
+}
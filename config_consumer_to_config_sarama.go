@@ -11,12 +11,14 @@ func (c consumerConfig) ToSaramaConfig() saramaConfig {
 			saramaCfg = saramaCfg.WithOffsetInitialNewest()
 		case offsetInitialOldest:
 			saramaCfg = saramaCfg.WithOffsetInitialOldest()
+		case isolationReadCommitted:
+			saramaCfg = saramaCfg.WithIsolationReadCommitted()
 		default:
 			// do nothing
 		}
 	}
 	// set channel buffer size sarama to equal to consumer buffer size
-	saramaCfg.saramaConfig.ChannelBufferSize = int(c.bufferSize)
+	saramaCfg.saramaConfig.ChannelBufferSize = int(c.topicConfig.bufferSize)
 
 	return saramaCfg
 }
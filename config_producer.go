@@ -1,10 +1,24 @@
 package tessara
 
-import "time"
+import (
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mrbryside/tessara/logger"
+)
 
 // producerConfig represents the configuration for a producer.
 type producerConfig struct {
 	brokers []string
+	logger  logger.Logger
+
+	tracerProvider trace.TracerProvider
+
+	// resultsBufferSize is the buffer size of the results channel of the async producer, results channel is disabled when it's 0
+	resultsBufferSize int
 
 	saramaConfig []any
 }
@@ -13,18 +27,43 @@ type producerConfig struct {
 func NewProducerConfig(brokers []string) producerConfig {
 	return producerConfig{
 		brokers: brokers,
+		logger:  logger.Default(),
+
+		tracerProvider: otel.GetTracerProvider(),
 	}
 }
 
+// WithLogger sets the logger of the producer, nil logger falls back to the default. (default: zerolog to stdout enabled by TESSARA_ENABLE_LOG)
+func (pc producerConfig) WithLogger(l logger.Logger) producerConfig {
+	if l == nil {
+		l = logger.Default()
+	}
+	pc.logger = l
+	return pc
+}
+
+// WithTracerProvider sets the tracer provider of the producer spans, nil tracer provider falls back to the default. (default: otel global tracer provider)
+func (pc producerConfig) WithTracerProvider(tp trace.TracerProvider) producerConfig {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	pc.tracerProvider = tp
+	return pc
+}
+
+// WithResultsChannel enables the results channel of the async producer, delivery result of every message is sent to the channel
+// so it must be drained by the caller. (default: disabled, results are only passed to the callbacks)
+func (pc producerConfig) WithResultsChannel(bufferSize int) producerConfig {
+	pc.resultsBufferSize = bufferSize
+	return pc
+}
+
 /*
 sarama config functions, config below will transform to sarama configuration to put into sarama.Config when creating a new consumer group.
 */
 
 // WithSASL sets the SASL configuration for the consumer.
 func (pc producerConfig) WithSASL(username, password string) producerConfig {
-	if username == "" || password == "" {
-		panic("username and password must not be empty")
-	}
 	pc.saramaConfig = append(pc.saramaConfig, sasl{
 		Username: username,
 		Password: password,
@@ -48,4 +87,68 @@ func (pc producerConfig) WithTimeout(timeout time.Duration) producerConfig {
 	return pc
 }
 
+// WithPartitioner sets the partitioner of the messages that are not produced to an explicit partition,
+// use NewMurmur2Partitioner or NewCRC32Partitioner to route keys the same way as Java or librdkafka clients. (default: murmur3 partitioner)
+func (pc producerConfig) WithPartitioner(p partitioner) producerConfig {
+	pc.saramaConfig = append(pc.saramaConfig, producerPartitioner{
+		Partitioner: p,
+	})
+	return pc
+}
+
+// WithTransactionalID makes the producer transactional with the transactional id, idempotence is turned on.
+// it's required by NewTransactionalProducer.
+func (pc producerConfig) WithTransactionalID(id string) producerConfig {
+	pc.saramaConfig = append(pc.saramaConfig, producerTransaction{
+		ID: id,
+	})
+	return pc
+}
+
+// WithLinger configures the async producer to wait up to the linger time to batch messages before sending them. (default: sarama default, sending immediately)
+func (pc producerConfig) WithLinger(linger time.Duration) producerConfig {
+	pc.saramaConfig = append(pc.saramaConfig, producerLinger{
+		Duration: linger,
+	})
+	return pc
+}
+
+// WithBatchSize configures the async producer to send the batch once it reaches the number of messages. (default: sarama default, sending immediately)
+func (pc producerConfig) WithBatchSize(messages int) producerConfig {
+	pc.saramaConfig = append(pc.saramaConfig, producerBatchSize{
+		Messages: messages,
+	})
+	return pc
+}
+
 //------------
+
+// Validate returns every problem of the producer configuration joined into one error, it returns nil if the configuration is valid.
+func (pc producerConfig) Validate() error {
+	var errs []error
+	if len(pc.brokers) == 0 {
+		errs = append(errs, errors.New("brokers must not be empty"))
+	}
+	if pc.resultsBufferSize < 0 {
+		errs = append(errs, errors.New("results channel buffer size must be greater than or equal to 0"))
+	}
+	errs = append(errs, validateSaramaConfig(pc.saramaConfig))
+	if pc.isTransactional() {
+		for _, sc := range pc.saramaConfig {
+			if r, ok := sc.(producerRetry); ok && r.Max < 1 {
+				errs = append(errs, errors.New("producer retry max must be greater than 0 for transactional producer"))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isTransactional returns true if the transactional id is set.
+func (pc producerConfig) isTransactional() bool {
+	for _, sc := range pc.saramaConfig {
+		if _, ok := sc.(producerTransaction); ok {
+			return true
+		}
+	}
+	return false
+}
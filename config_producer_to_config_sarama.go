@@ -11,6 +11,14 @@ func (c producerConfig) ToSaramaConfig() saramaConfig {
 			saramaCfg = saramaCfg.WithProducerRetry(configType.Max)
 		case producerTimeout:
 			saramaCfg = saramaCfg.WithProducerTimeout(configType.Duration)
+		case producerTransaction:
+			saramaCfg = saramaCfg.WithProducerTransaction(configType.ID)
+		case producerPartitioner:
+			saramaCfg = saramaCfg.WithProducerPartitioner(configType.Partitioner)
+		case producerLinger:
+			saramaCfg = saramaCfg.WithProducerFlushFrequency(configType.Duration)
+		case producerBatchSize:
+			saramaCfg = saramaCfg.WithProducerFlushMessages(configType.Messages)
 		default:
 			// do nothing
 		}
@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/IBM/sarama"
-	"github.com/twmb/murmur3"
 
 	"github.com/mrbryside/tessara/sacmclient"
 )
@@ -44,7 +43,7 @@ func setDefaultSetting(c sarama.Config) sarama.Config {
 	c.Producer.Return.Errors = true
 	c.Producer.Retry.Max = 3
 	c.Producer.Timeout = 3 * time.Second
-	c.Producer.Partitioner = sarama.NewCustomHashPartitioner(murmur3.New32)
+	c.Producer.Partitioner = NewMurmur3Partitioner().explicitPartitionConstructor()
 
 	// default another
 	c.Net.KeepAlive = 5 * time.Second
@@ -86,6 +85,40 @@ func (s saramaConfig) WithProducerTimeout(timeout time.Duration) saramaConfig {
 	return s
 }
 
+// WithProducerFlushFrequency configures the async producer to send the batch once the frequency is passed.
+func (s saramaConfig) WithProducerFlushFrequency(frequency time.Duration) saramaConfig {
+	s.saramaConfig.Producer.Flush.Frequency = frequency
+	return s
+}
+
+// WithProducerFlushMessages configures the async producer to send the batch once it reaches the number of messages.
+func (s saramaConfig) WithProducerFlushMessages(messages int) saramaConfig {
+	s.saramaConfig.Producer.Flush.Messages = messages
+	return s
+}
+
+// WithProducerPartitioner sets the partitioner of the producer, explicit partition of the message is still honored.
+func (s saramaConfig) WithProducerPartitioner(p partitioner) saramaConfig {
+	s.saramaConfig.Producer.Partitioner = p.explicitPartitionConstructor()
+	return s
+}
+
+// WithIsolationReadCommitted configures the consumer to only read records of committed transactions.
+func (s saramaConfig) WithIsolationReadCommitted() saramaConfig {
+	s.saramaConfig.Consumer.IsolationLevel = sarama.ReadCommitted
+	return s
+}
+
+// WithProducerTransaction configures the producer to be transactional, transaction requires the idempotent producer
+// so idempotence is turned on with acks from all replicas and one in flight request per connection.
+func (s saramaConfig) WithProducerTransaction(transactionalID string) saramaConfig {
+	s.saramaConfig.Producer.Transaction.ID = transactionalID
+	s.saramaConfig.Producer.Idempotent = true
+	s.saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	s.saramaConfig.Net.MaxOpenRequests = 1
+	return s
+}
+
 // Config returns a pointer to the underlying sarama.Config.
 func (s saramaConfig) Config() *sarama.Config {
 	return &s.saramaConfig
@@ -0,0 +1,209 @@
+package tessara
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+// topicConfig represents the pipeline configuration (memory buffer, subqueue, retry, committer) of a single topic.
+type topicConfig struct {
+	topic string
+
+	// memory buffer config
+	bufferSize                      uint64
+	waterMarkUpdateBlockingInterval time.Duration
+	pushMessageBlockingInterval     time.Duration
+
+	// message handler config, retry policy is inherited from the consumer when it's not set
+	retryPolicy     *RetryPolicy
+	handlerTimeout  time.Duration
+	deadLetterTopic string
+	failurePolicy   FailurePolicy
+
+	// retry topic config
+	retryTopicDelays []time.Duration
+
+	// subqueue config
+	subqueueNumber int
+	subqueueMode   string
+
+	// batch config, only used by batch message handler
+	batchMaxSize   int
+	batchMaxLinger time.Duration
+
+	// comitter config
+	commitInterval       time.Duration
+	commitGiveUpInterval time.Duration
+	commitGiveUpTime     time.Duration
+}
+
+// NewTopicConfig creates a new topic configuration, it's used to add more topics to a consumer with its own pipeline settings.
+func NewTopicConfig(topic string) topicConfig {
+	tc := topicConfig{
+		topic: topic,
+	}
+
+	// default config
+	tc.bufferSize = 256
+	tc.subqueueNumber = 1
+	tc.subqueueMode = "key_distribute"
+	tc.failurePolicy = FailurePolicyBlock
+	tc.batchMaxSize = 100
+	tc.batchMaxLinger = 100 * time.Millisecond
+	tc.commitInterval = 3 * time.Second
+	tc.commitGiveUpInterval = 10 * time.Second
+	tc.commitGiveUpTime = 120 * time.Second
+	tc.waterMarkUpdateBlockingInterval = 10 * time.Millisecond
+	tc.pushMessageBlockingInterval = 10 * time.Millisecond
+
+	return tc
+}
+
+// WithBufferSize sets the buffer size for the topic. (default: 256)
+func (tc topicConfig) WithBufferSize(bufferSize uint64) topicConfig {
+	tc.bufferSize = bufferSize
+	return tc
+}
+
+// WithRoundRobinMode sets the round robin mode for the topic. (default: key_distribute)
+func (tc topicConfig) WithRoundRobinMode() topicConfig {
+	tc.subqueueMode = "round_robin"
+	return tc
+}
+
+// WithKeyDistributeMode sets the key distribute mode for the topic. (default: key_distribute)
+func (tc topicConfig) WithKeyDistributeMode() topicConfig {
+	tc.subqueueMode = "key_distribute"
+	return tc
+}
+
+// WithCommitGiveUpInterval sets the commit give up interval for the topic. (default: 10 seconds)
+func (tc topicConfig) WithCommitGiveUpInterval(commitGiveUpInterval time.Duration) topicConfig {
+	tc.commitGiveUpInterval = commitGiveUpInterval
+	return tc
+}
+
+// WithCommitGiveUpTime sets the commit give up time for the topic. (default: 120 seconds)
+func (tc topicConfig) WithCommitGiveUpTime(commitGiveUpTime time.Duration) topicConfig {
+	tc.commitGiveUpTime = commitGiveUpTime
+	return tc
+}
+
+// WithCommitInterval sets the commit interval for the topic. (default: 3 seconds)
+func (tc topicConfig) WithCommitInterval(commitInterval time.Duration) topicConfig {
+	tc.commitInterval = commitInterval
+	return tc
+}
+
+// WithBlockingInterval sets the blocking interval that the topic pipeline will wait before pushMessage, update watermark. (default: 10 millisecs)
+func (tc topicConfig) WithBlockingInterval(blockingInterval time.Duration) topicConfig {
+	tc.waterMarkUpdateBlockingInterval = blockingInterval
+	tc.pushMessageBlockingInterval = blockingInterval
+
+	return tc
+}
+
+// WithRetry sets the exponential retry configuration for the topic, it overrides the retry policy of the consumer. (default: retry policy of the consumer)
+func (tc topicConfig) WithRetry(maxRetry int, retryMultiplier float64) topicConfig {
+	return tc.WithRetryPolicy(NewExponentialRetryPolicy(maxRetry, backoff.DefaultInitialInterval, retryMultiplier))
+}
+
+// WithRetryPolicy sets the retry policy for the topic, it overrides the retry policy of the consumer. (default: retry policy of the consumer)
+func (tc topicConfig) WithRetryPolicy(retryPolicy RetryPolicy) topicConfig {
+	tc.retryPolicy = &retryPolicy
+	return tc
+}
+
+// WithSubqueue sets the subqueue number for the topic. (default: 1)
+func (tc topicConfig) WithSubqueue(subqueueNumber int) topicConfig {
+	tc.subqueueNumber = subqueueNumber
+	return tc
+}
+
+// WithBatch sets the batch max size and batch max linger for the batch message handler of the topic,
+// subqueue handles the batch once it reaches max size or max linger is passed since the first message of the batch. (default: 100 messages, 100 millisecs)
+func (tc topicConfig) WithBatch(batchMaxSize int, batchMaxLinger time.Duration) topicConfig {
+	tc.batchMaxSize = batchMaxSize
+	tc.batchMaxLinger = batchMaxLinger
+	return tc
+}
+
+// WithHandlerTimeout sets the timeout of each perform attempt, the context given to the context message handler and the context batch message handler is cancelled once timeout is passed. 0 means no timeout. (default: no timeout)
+func (tc topicConfig) WithHandlerTimeout(handlerTimeout time.Duration) topicConfig {
+	tc.handlerTimeout = handlerTimeout
+	return tc
+}
+
+// WithDeadLetterTopic sets the dead letter topic for the topic, message that run out of retries is published to the dead letter topic
+// instead of calling fallback, fallback is only called when the dead letter record is unable to publish, empty means no dead letter topic. (default: none)
+func (tc topicConfig) WithDeadLetterTopic(deadLetterTopic string) topicConfig {
+	tc.deadLetterTopic = deadLetterTopic
+	return tc
+}
+
+// WithRetryTopics sets the retry topic tiers for the topic e.g. delays 5s, 1m create orders.retry.5s -> orders.retry.1m -> dead letter topic,
+// message that run out of retries is published to the next tier with a not-before timestamp so the partition keeps moving,
+// retry topics are subscribed by the same consumer and have to be created before consuming. (default: none)
+func (tc topicConfig) WithRetryTopics(delays ...time.Duration) topicConfig {
+	tc.retryTopicDelays = delays
+	return tc
+}
+
+// WithFailurePolicy sets what happens to the message after the fallback is called, block keeps the watermark until commit give up restarts the claim,
+// mark done marks the message as done and stop partition stops the claim with the error. (default: block)
+func (tc topicConfig) WithFailurePolicy(failurePolicy FailurePolicy) topicConfig {
+	tc.failurePolicy = failurePolicy
+	return tc
+}
+
+// Validate returns every problem of the topic configuration joined into one error, it returns nil if the configuration is valid.
+func (tc topicConfig) Validate() error {
+	var errs []error
+	if tc.bufferSize <= 0 {
+		errs = append(errs, errors.New("buffer size must be greater than 0"))
+	}
+	if tc.subqueueMode != "round_robin" && tc.subqueueMode != "key_distribute" {
+		errs = append(errs, errors.New("subqueue mode must be round_robin or key_distribute"))
+	}
+	if tc.commitGiveUpInterval <= 0 {
+		errs = append(errs, errors.New("commit give up interval must be greater than 0"))
+	}
+	if tc.commitGiveUpTime <= 0 {
+		errs = append(errs, errors.New("commit give up time must be greater than 0"))
+	}
+	if tc.commitInterval <= 0 {
+		errs = append(errs, errors.New("commit interval must be greater than 0"))
+	}
+	if tc.waterMarkUpdateBlockingInterval <= 0 || tc.pushMessageBlockingInterval <= 0 {
+		errs = append(errs, errors.New("blocking interval must be greater than 0"))
+	}
+	if tc.retryPolicy != nil {
+		if err := tc.retryPolicy.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if tc.subqueueNumber <= 0 {
+		errs = append(errs, errors.New("subqueue number must be greater than 0"))
+	}
+	if tc.batchMaxSize <= 0 {
+		errs = append(errs, errors.New("batch max size must be greater than 0"))
+	}
+	if tc.batchMaxLinger <= 0 {
+		errs = append(errs, errors.New("batch max linger must be greater than 0"))
+	}
+	if tc.handlerTimeout < 0 {
+		errs = append(errs, errors.New("handler timeout must be greater than or equal to 0"))
+	}
+	for _, delay := range tc.retryTopicDelays {
+		if delay < time.Millisecond {
+			errs = append(errs, errors.New("retry topic delay must be greater than or equal to 1 millisecond"))
+			break
+		}
+	}
+	if !tc.failurePolicy.isValid() {
+		errs = append(errs, errors.New("failure policy must be block, mark_done or stop_partition"))
+	}
+	return errors.Join(errs...)
+}
@@ -3,16 +3,18 @@ package tessara
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/IBM/sarama"
-	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/mrbryside/tessara/logger"
-	"github.com/mrbryside/tessara/metric"
 )
 
 var (
@@ -21,112 +23,301 @@ var (
 	}
 )
 
-var registerMetricsOnce sync.Once
-
 // Consumer represents a Consumer instance
 type Consumer struct {
 	consumerGroupHandler *consumerGroupHandler
 	consumerConfig       consumerConfig
+	// logLevel filters the log lines of the consumer, it's changed at runtime by the admin handler
+	logLevel *logger.LevelVar
 }
 
 // NewConsumer creates a new consumer instance
 func NewConsumer(cfg consumerConfig, mh messageHandler) Consumer {
-	// register metrics
-	registerMetricsOnce.Do(func() {
-		if os.Getenv("TESSARA_REGISTER_METRICS") == "true" {
-			prometheus.MustRegister(metric.MemoryBufferSize)
-			prometheus.MustRegister(metric.CurrentWaterMark)
-			prometheus.MustRegister(metric.CurrentBuffer)
-			prometheus.MustRegister(metric.PushToBufferWatingTime)
-			prometheus.MustRegister(metric.SubqueueCount)
-			prometheus.MustRegister(metric.SubqueueChannelBufferSize)
-			prometheus.MustRegister(metric.SubqueueMessageProcessedCount)
-			prometheus.MustRegister(metric.SubqueueMessageProcessingCount)
-			prometheus.MustRegister(metric.SubqueueMessageProcessingTime)
-			prometheus.MustRegister(metric.SubqueueMessageErrorCount)
-		}
-	})
+	return newConsumer(cfg, topicHandler{topicConfig: cfg.topicConfig, messageHandler: messageHandlerAdapter{mh}})
+}
+
+// NewContextConsumer creates a new consumer instance that handles messages with context, context is derived from
+// the consumer group session and it's cancelled on rebalance, shutdown or handler timeout
+func NewContextConsumer(cfg consumerConfig, cmh contextMessageHandler) Consumer {
+	return newConsumer(cfg, topicHandler{topicConfig: cfg.topicConfig, messageHandler: cmh})
+}
+
+// NewBatchConsumer creates a new consumer instance that handles messages in batches
+func NewBatchConsumer(cfg consumerConfig, bmh batchMessageHandler) Consumer {
+	return newConsumer(cfg, topicHandler{topicConfig: cfg.topicConfig, batchMessageHandler: batchMessageHandlerAdapter{bmh}})
+}
+
+// NewContextBatchConsumer creates a new consumer instance that handles messages in batches with context, context is derived from
+// the consumer group session and it's cancelled on rebalance, shutdown or handler timeout
+func NewContextBatchConsumer(cfg consumerConfig, cbmh contextBatchMessageHandler) Consumer {
+	return newConsumer(cfg, topicHandler{topicConfig: cfg.topicConfig, batchMessageHandler: cbmh})
+}
 
+// NewTransformConsumer creates a new consumer instance of the exactly-once consume-transform-produce pipeline,
+// outputs of the transform message handler are produced with the offset of the consumed message in one transaction
+// following the order of the memory buffer water mark, it replaces the periodic offset commit of the consumer.
+// consumers of the output topics have to read with WithIsolationReadCommitted to skip the outputs of aborted transactions
+func NewTransformConsumer(cfg consumerConfig, tmh transformMessageHandler) Consumer {
+	return newConsumer(cfg, topicHandler{topicConfig: cfg.topicConfig, messageHandler: transformHandlerAdapter{tmh}})
+}
+
+// newConsumer creates a new consumer instance with the topic handler of the topic given to consumer config
+func newConsumer(cfg consumerConfig, th topicHandler) Consumer {
+	lv := &logger.LevelVar{}
+	cfg.logger = logger.NewLeveledLogger(cfg.logger, lv)
 	return Consumer{
-		consumerGroupHandler: newConsumerGroupHandler(mh, newLoggingErrorHandler(), cfg),
+		consumerGroupHandler: newConsumerGroupHandler(th, newLoggingErrorHandler(cfg.logger), cfg),
 		consumerConfig:       cfg,
+		logLevel:             lv,
 	}
 }
 
+// WithTopic subscribes the consumer to one more topic with its own pipeline configuration and message handler,
+// all topics are sharing the same consumer group and lifecycle
+func (c Consumer) WithTopic(tc topicConfig, mh messageHandler) Consumer {
+	return c.withTopicHandler(topicHandler{topicConfig: tc, messageHandler: messageHandlerAdapter{mh}})
+}
+
+// WithContextTopic subscribes the consumer to one more topic with its own pipeline configuration and context message handler
+func (c Consumer) WithContextTopic(tc topicConfig, cmh contextMessageHandler) Consumer {
+	return c.withTopicHandler(topicHandler{topicConfig: tc, messageHandler: cmh})
+}
+
+// WithBatchTopic subscribes the consumer to one more topic with its own pipeline configuration and batch message handler
+func (c Consumer) WithBatchTopic(tc topicConfig, bmh batchMessageHandler) Consumer {
+	return c.withTopicHandler(topicHandler{topicConfig: tc, batchMessageHandler: batchMessageHandlerAdapter{bmh}})
+}
+
+// WithContextBatchTopic subscribes the consumer to one more topic with its own pipeline configuration and context batch message handler
+func (c Consumer) WithContextBatchTopic(tc topicConfig, cbmh contextBatchMessageHandler) Consumer {
+	return c.withTopicHandler(topicHandler{topicConfig: tc, batchMessageHandler: cbmh})
+}
+
+// WithTransformTopic subscribes the consumer to one more topic with its own pipeline configuration and transform message handler
+func (c Consumer) WithTransformTopic(tc topicConfig, tmh transformMessageHandler) Consumer {
+	return c.withTopicHandler(topicHandler{topicConfig: tc, messageHandler: transformHandlerAdapter{tmh}})
+}
+
+// withTopicHandler validates and registers the topic handler, problems are returned by Validate and StartConsume
+func (c Consumer) withTopicHandler(th topicHandler) Consumer {
+	c.consumerGroupHandler.validateTopicHandler(th)
+	c.consumerGroupHandler.addTopicHandler(th)
+	return c
+}
+
 // WithErrorHandler sets the error handler for the consumer group
 func (c Consumer) WithErrorHandler(eh errorHandler) Consumer {
 	c.consumerGroupHandler.errorHandler = eh
 	return c
 }
 
-// StartConsume starts the consumer group and will be block until context is cancelled or signal is received
-func (c Consumer) StartConsume(ctx context.Context) {
-	// init log
-	logger.Init()
+// Health returns the health of the consumer, consumer is ready once the group session is established and partitions are assigned
+func (c Consumer) Health() Health {
+	return c.consumerGroupHandler.health.health()
+}
+
+// LivenessHandler returns the http handler that responds 503 when the consumer is not healthy
+func (c Consumer) LivenessHandler() http.Handler {
+	return healthHandler(c.consumerGroupHandler.health, func(h Health) bool {
+		return h.Healthy
+	})
+}
+
+// ReadinessHandler returns the http handler that responds 503 when the consumer is not ready or not healthy
+func (c Consumer) ReadinessHandler() http.Handler {
+	return healthHandler(c.consumerGroupHandler.health, func(h Health) bool {
+		return h.Ready && h.Healthy
+	})
+}
+
+// AdminHandler returns the opt-in http handler for runtime introspection and control of the consumer, it shows the memory buffer,
+// subqueues and committer of every claimed partition and offers pause, resume, force commit and log level change,
+// mount it with http.StripPrefix when it's served under a path prefix
+func (c Consumer) AdminHandler() http.Handler {
+	return adminHandler(c.consumerGroupHandler.health, c.logLevel)
+}
+
+// Validate returns every problem of the consumer config and the topics added to the consumer joined into one error
+func (c Consumer) Validate() error {
+	return errors.Join(c.consumerConfig.Validate(), c.consumerGroupHandler.err())
+}
+
+// StartConsume starts the consumer group and will be block until context is cancelled or signal is received,
+// it returns error when the config is invalid, brokers are unreachable or consuming is failed
+func (c Consumer) StartConsume(ctx context.Context) (err error) {
+	if err = c.Validate(); err != nil {
+		return fmt.Errorf("invalid consumer config: %w", err)
+	}
+
+	// register metrics of the consumer
+	if c.consumerConfig.metricsRegisterer != nil {
+		if err = c.consumerGroupHandler.metrics.Register(c.consumerConfig.metricsRegisterer); err != nil {
+			return fmt.Errorf("unable to register metrics: %w", err)
+		}
+	}
 
 	// convert config to sarama config
 	saramaCfg := c.consumerConfig.ToSaramaConfig().Config()
-	consumerGroup, err := sarama.NewConsumerGroup(c.consumerConfig.brokers, c.consumerConfig.consumerGroupID, saramaCfg)
+	// set channel buffer size sarama to equal to the biggest buffer size of all topics
+	saramaCfg.ChannelBufferSize = int(c.consumerGroupHandler.maxBufferSize())
+	client, err := sarama.NewClient(c.consumerConfig.brokers, saramaCfg)
 	if err != nil {
-		logger.Panic().Err(err).Msg("unable to create sarama consumer group")
+		return fmt.Errorf("unable to create sarama client: %w", err)
+	}
+	defer func() {
+		if closeErr := client.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("error closing client: %w", closeErr))
+		}
+	}()
+	consumerGroup, err := sarama.NewConsumerGroupFromClient(c.consumerConfig.consumerGroupID, client)
+	if err != nil {
+		return fmt.Errorf("unable to create sarama consumer group: %w", err)
+	}
+	defer func() {
+		if closeErr := consumerGroup.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("error closing consumer group: %w", closeErr))
+		}
+	}()
+	c.consumerGroupHandler.health.setConsumerGroup(consumerGroup)
+	tr := newTopicResolver(client, c.consumerGroupHandler.topics, c.consumerConfig.topicPattern, c.consumerGroupHandler.patternExcludedTopics())
+
+	// create producer for retry and dead letter topics
+	if c.consumerGroupHandler.isProducerRequired() {
+		producer, err := NewSyncProducer(c.consumerConfig.toProducerConfig())
+		if err != nil {
+			return err
+		}
+		defer producer.Producer.Close()
+		c.consumerGroupHandler.producer = producer
 	}
 
-	// start consume group this line will return sync wait group
-	wg := c.consume(ctx, consumerGroup)
-	logger.Debug().Msg("consumer started!")
+	// consume context is cancelled when consumer is terminated, it's stopping the consume loop
+	consumeCtx, cancelConsume := context.WithCancel(ctx)
+	defer cancelConsume()
+
+	// start consume group this line will return sync wait group and the channel of consume errors
+	wg, consumeErrChan := c.consume(consumeCtx, consumerGroup, tr)
+	c.log().Info("consumer started!", "topics", c.consumerGroupHandler.topics)
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
 
 	select {
 	case <-ctx.Done():
-		logger.Debug().Msg("terminating consumer via context cancelled")
+		c.log().Info("terminating consumer via context cancelled")
 	case <-signals:
-		logger.Debug().Msg("terminating consumer consume via signal")
+		c.log().Info("terminating consumer consume via signal")
+	case err = <-consumeErrChan:
+		c.log().Error("terminating consumer via consume error", "error", err)
 	}
 
 	// waiting for consume done
+	cancelConsume()
 	wg.Wait()
 
-	if err = consumerGroup.Close(); err != nil {
-		logger.Panic().Err(err).Msg("error closing client")
-	}
-	logger.Debug().Msg("consumer closed!")
+	c.log().Info("consumer closed!")
+	return err
 }
 
-// consume starts consuming messages from the Kafka topic with error watching
-func (c Consumer) consume(ctx context.Context, cg sarama.ConsumerGroup) *sync.WaitGroup {
+// consume starts consuming messages from the Kafka topics with error watching,
+// consume loop is restarted with the new topic set once resolved topics are changed,
+// error that stops consuming is sent to the returned channel
+func (c Consumer) consume(ctx context.Context, cg sarama.ConsumerGroup, tr topicResolver) (*sync.WaitGroup, <-chan error) {
 	wg := &sync.WaitGroup{}
+	errChan := make(chan error, 2)
 	wg.Add(1)
 	go func() {
-		startErrorWatch(cg)
+		if err := startErrorWatch(cg); err != nil {
+			c.consumerGroupHandler.health.setFatal(err)
+			errChan <- err
+		}
 	}()
 	go func() {
 		defer wg.Done()
 		for {
-			err := cg.Consume(ctx, []string{c.consumerConfig.topic}, c.consumerGroupHandler)
+			topics, err := tr.Resolve()
+			if err != nil {
+				err = fmt.Errorf("unable to resolve topics: %w", err)
+				c.consumerGroupHandler.health.setFatal(err)
+				errChan <- err
+				return
+			}
+			if len(topics) == 0 {
+				// no topic matched the pattern yet, wait for the next refresh
+				c.log().Info("no topic to consume, waiting for topic refresh")
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(c.consumerConfig.topicRefreshInterval):
+					continue
+				}
+			}
+
+			consumeCtx, cancelConsume := context.WithCancel(ctx)
+			if tr.IsDynamic() {
+				go func() {
+					c.watchTopicChange(consumeCtx, cancelConsume, tr, topics)
+				}()
+			}
+			err = cg.Consume(consumeCtx, topics, c.consumerGroupHandler)
+			cancelConsume()
 			if err != nil {
 				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
 					return
 				}
-				logger.Panic().Err(err).Msg("unable to consume")
+				err = fmt.Errorf("unable to consume: %w", err)
+				c.consumerGroupHandler.health.setFatal(err)
+				errChan <- err
+				return
 			}
 			if ctx.Err() != nil {
 				return
 			}
 		}
 	}()
-	return wg
+	return wg, errChan
+}
+
+// watchTopicChange re-checks the topics on refresh interval and cancel the consume loop when the topic set is changed
+func (c Consumer) watchTopicChange(ctx context.Context, cancelConsume context.CancelFunc, tr topicResolver, topics []string) {
+	ticker := time.NewTicker(c.consumerConfig.topicRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			latestTopics, err := tr.Resolve()
+			if err != nil {
+				c.log().Warn("unable to refresh topics", "error", err)
+				continue
+			}
+			if !slices.Equal(topics, latestTopics) {
+				c.log().Info("topics changed, restarting consume loop", "topics", latestTopics)
+				cancelConsume()
+				return
+			}
+		}
+	}
+}
+
+// log returns the logger of the consumer with consumer group field
+func (c Consumer) log() logger.Logger {
+	return c.consumerConfig.logger.With("group", c.consumerConfig.consumerGroupID)
 }
 
-// startErrorWatch starts watching for errors from the consumer group sarama will return to Errors() channel
-func startErrorWatch(cg sarama.ConsumerGroup) {
+// startErrorWatch starts watching for errors from the consumer group sarama will return to Errors() channel,
+// it returns the error that consuming can not recover from
+func startErrorWatch(cg sarama.ConsumerGroup) error {
 	for err := range cg.Errors() {
 		if err == nil {
 			continue
 		}
 		if errors.Is(err, sarama.ErrOffsetOutOfRange) {
-			logger.Panic().Err(err).Msg("error offset out of range")
+			return fmt.Errorf("error offset out of range: %w", err)
 		}
 	}
+	return nil
 }
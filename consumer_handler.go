@@ -1,7 +1,11 @@
 package tessara
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"regexp"
+	"slices"
 
 	"github.com/IBM/sarama"
 
@@ -9,68 +13,330 @@ import (
 	"github.com/mrbryside/tessara/metric"
 )
 
+// topicHandler represents the pipeline configuration and the message handler of a subscribed topic,
+// only one of message handler or batch message handler is set
+type topicHandler struct {
+	topicConfig         topicConfig
+	messageHandler      contextMessageHandler
+	batchMessageHandler contextBatchMessageHandler
+	retryTier           retryTier
+}
+
+// retryableHandler creates the retryable handler of the topic
+func (th topicHandler) retryableHandler() retryableHandler {
+	if th.batchMessageHandler != nil {
+		return newBatchRetryableHandler(th.batchMessageHandler, *th.topicConfig.retryPolicy, th.topicConfig.handlerTimeout)
+	}
+	return newRetryableHandler(th.messageHandler, *th.topicConfig.retryPolicy, th.topicConfig.handlerTimeout)
+}
+
+// isTransform returns true if outputs of the message handler are produced in the commit transaction
+func (th topicHandler) isTransform() bool {
+	_, ok := th.messageHandler.(transformHandlerAdapter)
+	return ok
+}
+
+// withDefaultRetryPolicy sets the retry policy of the topic to the given retry policy if the topic has no retry policy of its own
+func (th topicHandler) withDefaultRetryPolicy(retryPolicy RetryPolicy) topicHandler {
+	if th.topicConfig.retryPolicy == nil {
+		th.topicConfig.retryPolicy = &retryPolicy
+	}
+	return th
+}
+
 // customerHandler is a struct that implements the sarama.consumerGroupHandler interface
 type consumerGroupHandler struct {
-	messageHandler messageHandler
-	errorHandler   errorHandler
-	consumerConfig consumerConfig
+	topics        []string
+	topicHandlers map[string]topicHandler
+	errorHandler  errorHandler
+	retryPolicy   RetryPolicy
+	logger        logger.Logger
+	groupID       string
+	metrics       *metric.Metrics
+
+	// topics matched by the pattern are using pattern topic handler as a template
+	topicPattern        *regexp.Regexp
+	patternTopicHandler topicHandler
+
+	// producer for publishing to retry and dead letter topics, it's only set when any topic has retry or dead letter topic
+	producer *syncProducer
+	tracer   messageTracer
+	health   *healthState
+
+	// producer config and transactional id prefix of the transactional producer of every claim of the transform topics
+	transactionalProducerConfig producerConfig
+	transactionalIDPrefix       string
+
+	// errs collects problems of the topics registered after the consumer config is created
+	errs []error
 }
 
 // newConsumerGroupHandler creates a new consumer handler
-func newConsumerGroupHandler(mh messageHandler, eh errorHandler, cfg consumerConfig) *consumerGroupHandler {
+func newConsumerGroupHandler(th topicHandler, eh errorHandler, cfg consumerConfig) *consumerGroupHandler {
 	ch := &consumerGroupHandler{
-		messageHandler: mh,
-		errorHandler:   eh,
-		consumerConfig: cfg,
+		topicHandlers: make(map[string]topicHandler),
+		errorHandler:  eh,
+		retryPolicy:   cfg.retryPolicy,
+		logger:        cfg.logger.With("group", cfg.consumerGroupID),
+		groupID:       cfg.consumerGroupID,
+		metrics:       metric.NewMetrics(cfg.metricsNamespace, cfg.metricsBuckets),
+		tracer:        newMessageTracer(cfg.tracerProvider, cfg.consumerGroupID),
+		health:        newHealthState(cfg.saturationThreshold),
+
+		transactionalProducerConfig: cfg.toProducerConfig(),
+		transactionalIDPrefix:       cfg.transactionalIDPrefix,
+	}
+	if cfg.topicPattern != nil {
+		ch.topicPattern = cfg.topicPattern
+		ch.patternTopicHandler = th.withDefaultRetryPolicy(ch.retryPolicy)
+		// topic is optional when consumer is subscribed by pattern
+		if th.topicConfig.topic == "" {
+			return ch
+		}
 	}
+	ch.addTopicHandler(th)
 
 	return ch
 }
 
+// addTopicHandler registers a topic with its own pipeline configuration and message handler,
+// retry topics of the topic are registered with the same message handler
+func (ch *consumerGroupHandler) addTopicHandler(th topicHandler) {
+	th = th.withDefaultRetryPolicy(ch.retryPolicy)
+	delays := th.topicConfig.retryTopicDelays
+	for i := range delays {
+		tierTh := th
+		tierTh.topicConfig.topic = retryTopicName(th.topicConfig.topic, delays[i])
+		tierTh.topicConfig.retryTopicDelays = nil
+		// messages are waiting for the delay in the pipeline, commit give up time has to cover it
+		tierTh.topicConfig.commitGiveUpTime += delays[i]
+		tierTh.retryTier = retryTier{}
+		if i+1 < len(delays) {
+			tierTh.retryTier = retryTier{
+				nextTopic: retryTopicName(th.topicConfig.topic, delays[i+1]),
+				nextDelay: delays[i+1],
+			}
+		}
+		ch.registerTopicHandler(tierTh)
+	}
+	if len(delays) > 0 {
+		th.retryTier = retryTier{
+			nextTopic: retryTopicName(th.topicConfig.topic, delays[0]),
+			nextDelay: delays[0],
+		}
+	}
+	ch.registerTopicHandler(th)
+}
+
+// registerTopicHandler registers a topic handler to the subscribed topics
+func (ch *consumerGroupHandler) registerTopicHandler(th topicHandler) {
+	topic := th.topicConfig.topic
+	if topic == "" {
+		ch.errs = append(ch.errs, errors.New("topic must not be empty"))
+		return
+	}
+	if _, ok := ch.topicHandlers[topic]; ok {
+		ch.errs = append(ch.errs, fmt.Errorf("topic %s is already registered", topic))
+		return
+	}
+	ch.topics = append(ch.topics, topic)
+	ch.topicHandlers[topic] = th
+}
+
+// topicHandler returns the topic handler of the given topic, topics matched by the pattern get a copy of pattern topic handler
+func (ch *consumerGroupHandler) topicHandler(topic string) (topicHandler, bool) {
+	if th, ok := ch.topicHandlers[topic]; ok {
+		return th, true
+	}
+	if ch.topicPattern != nil && ch.topicPattern.MatchString(topic) && !slices.Contains(ch.patternExcludedTopics(), topic) {
+		th := ch.patternTopicHandler
+		th.topicConfig.topic = topic
+		return th, true
+	}
+	return topicHandler{}, false
+}
+
+// patternExcludedTopics returns the dead letter and retry topics of every topic, they're never handled as topics matched by the pattern
+func (ch *consumerGroupHandler) patternExcludedTopics() []string {
+	var topics []string
+	if ch.patternTopicHandler.topicConfig.deadLetterTopic != "" {
+		topics = append(topics, ch.patternTopicHandler.topicConfig.deadLetterTopic)
+	}
+	for _, th := range ch.topicHandlers {
+		if th.topicConfig.deadLetterTopic != "" {
+			topics = append(topics, th.topicConfig.deadLetterTopic)
+		}
+		if th.retryTier.nextTopic != "" {
+			topics = append(topics, th.retryTier.nextTopic)
+		}
+	}
+	return topics
+}
+
+// validateTopicHandler validates the topic config of the topic handler that is added after the consumer config is created
+func (ch *consumerGroupHandler) validateTopicHandler(th topicHandler) {
+	if err := th.topicConfig.Validate(); err != nil {
+		ch.errs = append(ch.errs, fmt.Errorf("invalid config of topic %s: %w", th.topicConfig.topic, err))
+	}
+}
+
+// err returns every problem of the registered topics joined into one error
+func (ch *consumerGroupHandler) err() error {
+	return errors.Join(ch.errs...)
+}
+
+// isProducerRequired returns true if any topic has retry or dead letter topic
+func (ch *consumerGroupHandler) isProducerRequired() bool {
+	if ch.patternTopicHandler.topicConfig.deadLetterTopic != "" {
+		return true
+	}
+	for _, th := range ch.topicHandlers {
+		if th.topicConfig.deadLetterTopic != "" || th.retryTier.nextTopic != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// newClaimTransactionalProducer creates the transactional producer of the claim, transactional id is bound to the partition
+// so the producer of the previous owner is fenced and its unfinished transaction is aborted after rebalance
+func (ch *consumerGroupHandler) newClaimTransactionalProducer(claim sarama.ConsumerGroupClaim) (*transactionalProducer, error) {
+	id := fmt.Sprintf("%s-%s-%d", ch.transactionalIDPrefix, claim.Topic(), claim.Partition())
+	tp, err := NewTransactionalProducer(ch.transactionalProducerConfig.WithTransactionalID(id))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create transactional producer of topic %s partition %d: %w", claim.Topic(), claim.Partition(), err)
+	}
+	return tp, nil
+}
+
+// maxBufferSize returns the biggest buffer size of all registered topics
+func (ch *consumerGroupHandler) maxBufferSize() uint64 {
+	maxBufferSize := ch.patternTopicHandler.topicConfig.bufferSize
+	for _, th := range ch.topicHandlers {
+		maxBufferSize = max(maxBufferSize, th.topicConfig.bufferSize)
+	}
+	return maxBufferSize
+}
+
 // Setup is called when the consumer is initialized
 func (ch *consumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
-	logger.Debug().
-		Any("session", session).
-		Msg("consumer handler setup called")
+	ch.logger.Debug("consumer handler setup called",
+		"member", session.MemberID(),
+		"generation", session.GenerationID(),
+	)
+	assignedPartitions := 0
+	for _, partitions := range session.Claims() {
+		assignedPartitions += len(partitions)
+	}
+	ch.health.setSession(true, assignedPartitions)
 	return nil
 }
 
 // Cleanup is called when the consumer is closed
 func (ch *consumerGroupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
-	logger.Debug().
-		Any("session", session).
-		Msg("consumer handler cleanup called")
-	metric.ClearMetrics()
+	ch.logger.Debug("consumer handler cleanup called",
+		"member", session.MemberID(),
+		"generation", session.GenerationID(),
+	)
+	ch.health.setSession(false, 0)
 	return nil
 }
 
 // ConsumeClaim this is main consume loop will call automatically by sarama when consumer receives a message
 // it's run in multiple goroutines by sarama)
 func (ch *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	th, ok := ch.topicHandler(claim.Topic())
+	if !ok {
+		return fmt.Errorf("no handler registered for topic %s", claim.Topic())
+	}
+	tc := th.topicConfig
+	claimLogger := ch.logger.With("topic", claim.Topic(), "partition", claim.Partition())
+	// metrics of the claim are removed when claim ends and every goroutine of the pipeline is stopped, other claims are not affected
+	claimMetrics := ch.metrics.Partition(ch.groupID, claim.Topic(), claim.Partition())
+	defer claimMetrics.Delete()
+
+	// outputs of the transform topic are produced with the water mark offset by the committer,
+	// producer is closed only after the committer is stopped
+	var tp *transactionalProducer
+	if th.isTransform() {
+		var err error
+		if tp, err = ch.newClaimTransactionalProducer(claim); err != nil {
+			return err
+		}
+		defer func() {
+			if err := tp.Close(); err != nil {
+				claimLogger.Error("unable to close transactional producer", "error", err)
+			}
+		}()
+	}
+
+	// claim context is cancelled when claim ends, it's stopping the pipeline and cancelling messages that are handling,
+	// goroutines of the pipeline are waited to stop before the producer is closed and the metrics are removed
+	ctx, cancel := context.WithCancel(session.Context())
+	var pipelineDone []<-chan struct{}
+	defer func() {
+		cancel()
+		for _, done := range pipelineDone {
+			<-done
+		}
+	}()
+
 	// create channel for receive error from comitter it's should be here because consumeClaim is run in multiple goroutine
 	commitGiveUpErrorChan := make(chan error)
-	mb := newMemoryBuffer(session.Context(), ch.consumerConfig.bufferSize, ch.consumerConfig.waterMarkUpdateBlockingInterval, ch.consumerConfig.pushMessageBlockingInterval)
-	cm := newCommitter(session.Context(), commitGiveUpErrorChan, ch.errorHandler, mb, session, claim, ch.consumerConfig.commitInterval, ch.consumerConfig.commitGiveUpInterval, ch.consumerConfig.commitGiveUpTime, ch.consumerConfig.pushMessageBlockingInterval)
-	rh := newRetryableHandler(ch.messageHandler, ch.consumerConfig.maxRetry, ch.consumerConfig.retryMultiplier)
-	sqs := newSubqueues(session.Context(), rh, ch.consumerConfig.bufferSize, ch.consumerConfig.pushMessageBlockingInterval, ch.consumerConfig.subqueueNumber)
-	sqq := newSubqueueQualifier(session.Context(), sqs, ch.consumerConfig.subqueueMode, ch.consumerConfig.bufferSize, ch.consumerConfig.pushMessageBlockingInterval)
-	ort := newOrchestrator(session.Context(), mb, sqq, cm, ch.consumerConfig.bufferSize, ch.consumerConfig.pushMessageBlockingInterval)
+	// create channel for receive error from subqueues when failure policy stops the partition
+	failureErrorChan := make(chan error)
+	mb := newMemoryBuffer(ctx, tc.bufferSize, tc.waterMarkUpdateBlockingInterval, tc.pushMessageBlockingInterval, claimMetrics)
+	pipelineDone = append(pipelineDone, mb.done)
+	if tp != nil {
+		// message buffers are kept until their outputs are produced
+		mb.withReleaseOnCommit()
+	}
+	cm := newCommitter(ctx, commitGiveUpErrorChan, ch.errorHandler, claimLogger, claimMetrics, mb, session, claim, tc.commitInterval, tc.commitGiveUpInterval, tc.commitGiveUpTime, tc.pushMessageBlockingInterval, tp, ch.groupID)
+	pipelineDone = append(pipelineDone, cm.done)
+	rh := th.retryableHandler().withErrorHandler(ch.errorHandler).withTracer(ch.tracer)
+	if th.retryTier.nextTopic != "" {
+		rh = rh.withRetryTopicPublisher(newRetryTopicPublisher(*ch.producer, th.retryTier.nextTopic, th.retryTier.nextDelay))
+	}
+	if tc.deadLetterTopic != "" {
+		rh = rh.withDeadLetterPublisher(newDeadLetterPublisher(*ch.producer, tc.deadLetterTopic))
+	}
+	sqs := newSubqueues(ctx, rh, tc.bufferSize, tc.pushMessageBlockingInterval, tc.subqueueNumber, tc.batchMaxSize, tc.batchMaxLinger, tc.failurePolicy, failureErrorChan, claimLogger, claimMetrics)
+	for _, sq := range sqs {
+		pipelineDone = append(pipelineDone, sq.done)
+	}
+	sqq, err := newSubqueueQualifier(ctx, sqs, tc.subqueueMode, tc.bufferSize, tc.pushMessageBlockingInterval)
+	if err != nil {
+		return err
+	}
+	pipelineDone = append(pipelineDone, sqq.done)
+	ch.health.addClaim(claim.Topic(), claim.Partition(), &claimState{committer: cm, subqueues: sqs})
+	defer ch.health.removeClaim(claim.Topic(), claim.Partition())
+	ort := newOrchestrator(ctx, mb, sqq, cm, ch.tracer, tc.bufferSize, tc.pushMessageBlockingInterval)
+	pipelineDone = append(pipelineDone, ort.done)
 
 	// consume message from channel and push message to orchestrator
 	for {
 		select {
-		case <-session.Context().Done():
+		case <-ctx.Done():
 			return nil
 
 		case errFromChan := <-commitGiveUpErrorChan:
+			// transaction error such as fencing is returned as is, so it's told apart from the stalled commit
+			if !errors.Is(errFromChan, errCommitGiveUp) {
+				return errFromChan
+			}
 			// return error to retry message that exceed commit give up time
 			return errors.Join(errFromChan, errors.New("skip processing message due to commit exceed give up time."))
 
+		case errFromChan := <-failureErrorChan:
+			// return error to stop the partition, message is reprocessed from the last commit after rebalance
+			return errors.Join(errFromChan, errors.New("stop processing partition due to failure policy."))
+
 		case msg, ok := <-claim.Messages():
 			if !ok {
 				return nil
 			}
-			ort.Push(session.Context(), msg)
+			ort.Push(ctx, msg)
 		}
 	}
 }
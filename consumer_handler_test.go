@@ -0,0 +1,93 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mrbryside/tessara/mock"
+)
+
+func TestConsumeClaimReturnsAfterPipelineIsStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	var handlerReturned atomic.Bool
+	cfg := NewConsumerConfig([]string{"fake broker"}, "orders", "orders-group").
+		WithCommitInterval(10 * time.Millisecond).
+		WithBlockingInterval(time.Millisecond)
+	ch := NewContextConsumer(cfg, funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		close(started)
+		<-ctx.Done()
+		// handler is still writing after the claim is revoked
+		time.Sleep(20 * time.Millisecond)
+		handlerReturned.Store(true)
+		return ctx.Err()
+	}}).consumerGroupHandler
+
+	messages := make(chan *sarama.ConsumerMessage, 1)
+	messages <- &sarama.ConsumerMessage{Topic: "orders", Partition: 0, Offset: 0}
+	claim := mock.NewConsumerGroupClaim(func() string { return "orders" }, func() int32 { return 0 }, nil, nil, messages)
+	session := mock.ConsumerGroupSession{ContextFunc: func() context.Context { return ctx }}
+
+	go func() {
+		<-started
+		cancel()
+	}()
+	assert.NoError(t, ch.ConsumeClaim(session, claim))
+	// metrics of the claim are deleted only after the subqueue is stopped
+	assert.True(t, handlerReturned.Load())
+}
+
+func TestConsumeClaimRoutesToHandlerOfClaimTopic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := NewConsumerConfig([]string{"fake broker"}, "orders", "orders-group").
+		WithBlockingInterval(time.Millisecond).
+		WithRetryPolicy(NewConstantRetryPolicy(5, time.Millisecond))
+	ordersHandler := funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		t.Errorf("handler of orders is called for %s", pm.Topic)
+		return nil
+	}}
+	var attempts atomic.Int32
+	var deadlineSet atomic.Bool
+	fallback := make(chan PerformMessage, 1)
+	paymentsHandler := funcMessageHandler{
+		perform: func(ctx context.Context, pm PerformMessage) error {
+			_, ok := ctx.Deadline()
+			deadlineSet.Store(ok)
+			attempts.Add(1)
+			return errors.New("payment gateway is unavailable")
+		},
+		fallback: func(ctx context.Context, pm PerformMessage, err error) {
+			fallback <- pm
+		},
+	}
+	ch := NewContextConsumer(cfg, ordersHandler).
+		WithContextTopic(NewTopicConfig("payments").
+			WithBlockingInterval(time.Millisecond).
+			WithHandlerTimeout(time.Minute).
+			WithRetryPolicy(NewConstantRetryPolicy(1, time.Millisecond)), paymentsHandler).
+		consumerGroupHandler
+
+	messages := make(chan *sarama.ConsumerMessage, 1)
+	messages <- &sarama.ConsumerMessage{Topic: "payments", Partition: 2, Offset: 7}
+	claim := mock.NewConsumerGroupClaim(func() string { return "payments" }, func() int32 { return 2 }, nil, nil, messages)
+	session := mock.ConsumerGroupSession{ContextFunc: func() context.Context { return ctx }}
+
+	go func() {
+		<-fallback
+		cancel()
+	}()
+	assert.NoError(t, ch.ConsumeClaim(session, claim))
+	// retry policy and handler timeout of payments are applied instead of the ones of orders
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.True(t, deadlineSet.Load())
+}
@@ -0,0 +1,55 @@
+package tessara
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/IBM/sarama"
+)
+
+// topicResolver resolves the topics that consumer group should subscribe, static topics plus topics in cluster metadata matched by the pattern
+// except the excluded topics
+type topicResolver struct {
+	client       sarama.Client
+	staticTopics []string
+	topicPattern *regexp.Regexp
+	// excludedTopics are the dead letter and retry topics of the consumer, they're not matched by the pattern
+	// so failed messages are not consumed again by the pattern handler
+	excludedTopics []string
+}
+
+// newTopicResolver creates a new topic resolver instance
+func newTopicResolver(client sarama.Client, staticTopics []string, topicPattern *regexp.Regexp, excludedTopics []string) topicResolver {
+	return topicResolver{
+		client:         client,
+		staticTopics:   staticTopics,
+		topicPattern:   topicPattern,
+		excludedTopics: excludedTopics,
+	}
+}
+
+// IsDynamic returns true if the topics can change over time
+func (tr topicResolver) IsDynamic() bool {
+	return tr.topicPattern != nil
+}
+
+// Resolve returns the sorted topic set, cluster metadata is refreshed before matching the pattern
+func (tr topicResolver) Resolve() ([]string, error) {
+	topics := slices.Clone(tr.staticTopics)
+	if tr.IsDynamic() {
+		if err := tr.client.RefreshMetadata(); err != nil {
+			return nil, err
+		}
+		clusterTopics, err := tr.client.Topics()
+		if err != nil {
+			return nil, err
+		}
+		for _, topic := range clusterTopics {
+			if tr.topicPattern.MatchString(topic) && !slices.Contains(tr.excludedTopics, topic) {
+				topics = append(topics, topic)
+			}
+		}
+	}
+	slices.Sort(topics)
+	return slices.Compact(topics), nil
+}
@@ -0,0 +1,146 @@
+package tessara
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubMetadataClient returns the topics of the cluster metadata, topics can be changed while it's used
+type stubMetadataClient struct {
+	sarama.Client
+
+	mu         sync.Mutex
+	topics     []string
+	refreshErr error
+	refreshes  int
+}
+
+func (c *stubMetadataClient) RefreshMetadata(topics ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshes++
+	return c.refreshErr
+}
+
+func (c *stubMetadataClient) Topics() ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.topics), nil
+}
+
+func (c *stubMetadataClient) setTopics(topics ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.topics = topics
+}
+
+// recordingConsumerGroup records the topics of every consume loop, consume is blocked until its context is cancelled
+type recordingConsumerGroup struct {
+	sarama.ConsumerGroup
+
+	consumed chan []string
+	errs     chan error
+}
+
+func (cg recordingConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	cg.consumed <- topics
+	<-ctx.Done()
+	return nil
+}
+
+func (cg recordingConsumerGroup) Errors() <-chan error {
+	return cg.errs
+}
+
+func TestTopicResolverMatchesPatternWithStaticTopics(t *testing.T) {
+	client := &stubMetadataClient{topics: []string{"payments-us", "invoices", "orders", "payments-eu", "__consumer_offsets"}}
+	tr := newTopicResolver(client, []string{"orders"}, regexp.MustCompile(`^payments-`), nil)
+
+	topics, err := tr.Resolve()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders", "payments-eu", "payments-us"}, topics)
+	assert.Equal(t, 1, client.refreshes)
+
+	// metadata is not refreshed when there is no pattern
+	topics, err = newTopicResolver(client, []string{"orders"}, nil, nil).Resolve()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, topics)
+	assert.Equal(t, 1, client.refreshes)
+}
+
+func TestTopicResolverResolvesNothingBeforeTopicIsCreated(t *testing.T) {
+	client := &stubMetadataClient{topics: []string{"invoices"}}
+	tr := newTopicResolver(client, nil, regexp.MustCompile(`^payments-`), nil)
+
+	topics, err := tr.Resolve()
+	assert.NoError(t, err)
+	assert.Empty(t, topics)
+
+	client.refreshErr = sarama.ErrOutOfBrokers
+	_, err = tr.Resolve()
+	assert.ErrorIs(t, err, sarama.ErrOutOfBrokers)
+}
+
+func TestTopicResolverSkipsDeadLetterAndRetryTopicsOfConsumer(t *testing.T) {
+	cfg := NewConsumerConfig([]string{"fake broker"}, "", "orders-group").
+		WithTopicPattern(regexp.MustCompile(`^orders\.`)).
+		WithDeadLetterTopic("orders.dlq")
+	c := NewConsumer(cfg, messageBenchMarkHandler{}).
+		WithTopic(NewTopicConfig("orders.eu").WithRetryTopics(5*time.Second).WithDeadLetterTopic("orders.eu.dlq"), messageBenchMarkHandler{})
+	ch := c.consumerGroupHandler
+	client := &stubMetadataClient{topics: []string{"orders.us", "orders.dlq", "orders.eu", "orders.eu.retry.5s", "orders.eu.dlq"}}
+
+	topics, err := newTopicResolver(client, ch.topics, cfg.topicPattern, ch.patternExcludedTopics()).Resolve()
+	assert.NoError(t, err)
+	// retry topic is still consumed by the handler of its topic
+	assert.Equal(t, []string{"orders.eu", "orders.eu.retry.5s", "orders.us"}, topics)
+	_, ok := ch.topicHandler("orders.dlq")
+	assert.False(t, ok)
+}
+
+func TestConsumeRestartsWhenTopicSetChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &stubMetadataClient{}
+	cfg := NewConsumerConfig([]string{"fake broker"}, "", "payments-group").
+		WithTopicPattern(regexp.MustCompile(`^payments-`)).
+		WithTopicRefreshInterval(5 * time.Millisecond)
+	c := NewConsumer(cfg, messageBenchMarkHandler{})
+	cg := recordingConsumerGroup{consumed: make(chan []string, 3), errs: make(chan error)}
+	defer close(cg.errs)
+
+	wg, errChan := c.consume(ctx, cg, newTopicResolver(client, nil, cfg.topicPattern, nil))
+	// consume loop waits until a topic matches the pattern
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, cg.consumed)
+
+	client.setTopics("payments-eu")
+	assert.Equal(t, []string{"payments-eu"}, receiveWithin(t, cg.consumed))
+	client.setTopics("payments-eu", "payments-us")
+	assert.Equal(t, []string{"payments-eu", "payments-us"}, receiveWithin(t, cg.consumed))
+
+	cancel()
+	wg.Wait()
+	assert.Empty(t, errChan)
+}
+
+// receiveWithin receives the value from the channel or fails the test after a second
+func receiveWithin[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for value")
+	}
+	var zero T
+	return zero
+}
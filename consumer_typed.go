@@ -0,0 +1,56 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// TypedMessage represents a message that is decoded by the codec of the typed consumer.
+type TypedMessage[T any] struct {
+	Value T
+	// Message is the message before it's decoded
+	Message PerformMessage
+}
+
+// typedMessageHandler is an interface for handling messages that are decoded by the codec,
+// fallback is given the message before it's decoded because value is not available when decoding is failed
+type typedMessageHandler[T any] interface {
+	Perform(context.Context, TypedMessage[T]) error
+	Fallback(context.Context, PerformMessage, error)
+}
+
+// typedHandlerAdapter adapts the typed message handler to the context message handler by decoding messages with the codec
+type typedHandlerAdapter[T any] struct {
+	codec               Codec[T]
+	typedMessageHandler typedMessageHandler[T]
+}
+
+// Perform decodes the message then calls perform of the typed message handler, decode error is permanent
+// except the schema registry is unavailable
+func (a typedHandlerAdapter[T]) Perform(ctx context.Context, pm PerformMessage) error {
+	v, err := decodeContext(ctx, a.codec, pm.Value)
+	if errors.Is(err, ErrSchemaRegistryUnavailable) {
+		return err
+	}
+	if err != nil {
+		return Permanent(fmt.Errorf("%w: %w", ErrDecode, err))
+	}
+	return a.typedMessageHandler.Perform(ctx, TypedMessage[T]{Value: v, Message: pm})
+}
+
+// Fallback calls fallback of the typed message handler
+func (a typedHandlerAdapter[T]) Fallback(ctx context.Context, pm PerformMessage, err error) {
+	a.typedMessageHandler.Fallback(ctx, pm, err)
+}
+
+// NewTypedConsumer creates a new consumer instance that decodes messages with the codec before they're handled,
+// message that is unable to be decoded goes straight to the dead letter topic or fallback with error of ErrDecode
+func NewTypedConsumer[T any](cfg consumerConfig, codec Codec[T], tmh typedMessageHandler[T]) Consumer {
+	return newConsumer(cfg, topicHandler{topicConfig: cfg.topicConfig, messageHandler: typedHandlerAdapter[T]{codec: codec, typedMessageHandler: tmh}})
+}
+
+// WithTypedTopic subscribes the consumer to one more topic with its own pipeline configuration, codec and typed message handler
+func WithTypedTopic[T any](c Consumer, tc topicConfig, codec Codec[T], tmh typedMessageHandler[T]) Consumer {
+	return c.withTopicHandler(topicHandler{topicConfig: tc, messageHandler: typedHandlerAdapter[T]{codec: codec, typedMessageHandler: tmh}})
+}
@@ -0,0 +1,67 @@
+package tessara
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// headers included in the record that is published to the dead letter topic
+const (
+	HeaderDeadLetterSourceTopic      = "tessara-dlq-source-topic"
+	HeaderDeadLetterSourcePartition  = "tessara-dlq-source-partition"
+	HeaderDeadLetterSourceOffset     = "tessara-dlq-source-offset"
+	HeaderDeadLetterError            = "tessara-dlq-error"
+	HeaderDeadLetterAttempts         = "tessara-dlq-attempts"
+	HeaderDeadLetterFirstFailureTime = "tessara-dlq-first-failure-time"
+)
+
+// deadLetterPublisher publishes the messages that run out of retries to the dead letter topic
+type deadLetterPublisher struct {
+	producer syncProducer
+	topic    string
+}
+
+// newDeadLetterPublisher creates a new dead letter publisher instance
+func newDeadLetterPublisher(producer syncProducer, topic string) *deadLetterPublisher {
+	return &deadLetterPublisher{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+// Publish publishes the consumer message with its original key, value and headers plus the failure headers,
+// source headers point to the original topic when the message is consumed from a retry topic,
+// it's returned once the record is acknowledged by the broker
+func (p *deadLetterPublisher) Publish(ctx context.Context, cm *sarama.ConsumerMessage, err error) error {
+	attempts, firstFailedAt := 1, time.Now()
+	if ee, ok := asExhaustedError(err); ok {
+		attempts, firstFailedAt = ee.attempts, ee.firstFailedAt
+	}
+
+	headers := fromSaramaHeaders(cm.Headers)
+	sourceTopic, sourcePartition, sourceOffset := []byte(cm.Topic), []byte(strconv.FormatInt(int64(cm.Partition), 10)), []byte(strconv.FormatInt(cm.Offset, 10))
+	if retrySourceTopic, ok := headers.Get(HeaderRetrySourceTopic); ok {
+		sourceTopic = retrySourceTopic
+		sourcePartition, _ = headers.Get(HeaderRetrySourcePartition)
+		sourceOffset, _ = headers.Get(HeaderRetrySourceOffset)
+	}
+	headers = append(headers,
+		Header{Key: HeaderDeadLetterSourceTopic, Value: sourceTopic},
+		Header{Key: HeaderDeadLetterSourcePartition, Value: sourcePartition},
+		Header{Key: HeaderDeadLetterSourceOffset, Value: sourceOffset},
+		Header{Key: HeaderDeadLetterError, Value: []byte(err.Error())},
+		Header{Key: HeaderDeadLetterAttempts, Value: []byte(strconv.Itoa(attempts))},
+		Header{Key: HeaderDeadLetterFirstFailureTime, Value: []byte(firstFailedAt.UTC().Format(time.RFC3339Nano))},
+	)
+
+	_, _, produceErr := p.producer.ProduceContext(ctx, ProducerMessage{
+		Topic:   p.topic,
+		Key:     string(cm.Key),
+		Headers: headers,
+		Value:   cm.Value,
+	})
+	return produceErr
+}
@@ -0,0 +1,87 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mrbryside/tessara/logger"
+)
+
+func TestDeadLetterPublishKeepsRecordAndAddsFailureHeaders(t *testing.T) {
+	mp := mocks.NewSyncProducer(t, nil)
+	defer mp.Close()
+
+	var published *sarama.ProducerMessage
+	mp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		published = msg
+		return nil
+	})
+
+	firstFailedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	dlp := newDeadLetterPublisher(syncProducer{Producer: mp, logger: logger.Default()}, "orders.dlq")
+	err := dlp.Publish(context.Background(), &sarama.ConsumerMessage{
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("order-1"),
+		Value:     []byte("payload"),
+		Headers:   []*sarama.RecordHeader{{Key: []byte("tenant-id"), Value: []byte("tenant-a")}},
+	}, &exhaustedError{err: errors.New("downstream unavailable"), attempts: 4, firstFailedAt: firstFailedAt})
+	assert.NoError(t, err)
+
+	assert.Equal(t, published.Topic, "orders.dlq")
+	key, _ := published.Key.Encode()
+	value, _ := published.Value.Encode()
+	assert.Equal(t, key, []byte("order-1"))
+	assert.Equal(t, value, []byte("payload"))
+
+	headers := map[string]string{}
+	for _, h := range published.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	assert.Equal(t, headers["tenant-id"], "tenant-a")
+	assert.Equal(t, headers[HeaderDeadLetterSourceTopic], "orders")
+	assert.Equal(t, headers[HeaderDeadLetterSourcePartition], "3")
+	assert.Equal(t, headers[HeaderDeadLetterSourceOffset], "42")
+	assert.Equal(t, headers[HeaderDeadLetterError], "downstream unavailable")
+	assert.Equal(t, headers[HeaderDeadLetterAttempts], "4")
+	assert.Equal(t, headers[HeaderDeadLetterFirstFailureTime], "2024-01-02T03:04:05Z")
+}
+
+func TestDeadLetterPublishPointsSourceToOriginalTopicOfRetryTopic(t *testing.T) {
+	mp := mocks.NewSyncProducer(t, nil)
+	defer mp.Close()
+
+	var published *sarama.ProducerMessage
+	mp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		published = msg
+		return nil
+	})
+
+	dlp := newDeadLetterPublisher(syncProducer{Producer: mp, logger: logger.Default()}, "orders.dlq")
+	err := dlp.Publish(context.Background(), &sarama.ConsumerMessage{
+		Topic:     "orders.retry.1",
+		Partition: 0,
+		Offset:    7,
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(HeaderRetrySourceTopic), Value: []byte("orders")},
+			{Key: []byte(HeaderRetrySourcePartition), Value: []byte("3")},
+			{Key: []byte(HeaderRetrySourceOffset), Value: []byte("42")},
+		},
+	}, errors.New("downstream unavailable"))
+	assert.NoError(t, err)
+
+	headers := map[string]string{}
+	for _, h := range published.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	assert.Equal(t, headers[HeaderDeadLetterSourceTopic], "orders")
+	assert.Equal(t, headers[HeaderDeadLetterSourcePartition], "3")
+	assert.Equal(t, headers[HeaderDeadLetterSourceOffset], "42")
+}
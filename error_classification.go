@@ -0,0 +1,97 @@
+package tessara
+
+import (
+	"errors"
+	"time"
+)
+
+// permanentError represents an error that will never succeed, message is not retried.
+type permanentError struct {
+	err error
+}
+
+// Error returns the error message of the wrapped error.
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// retryAfterError represents an error that should be retried after the given delay instead of the backoff interval.
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+// Error returns the error message of the wrapped error.
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// skipError represents an error that message should be marked successful without retry and fallback.
+type skipError struct {
+	err error
+}
+
+// Error returns the error message of the wrapped error.
+func (e *skipError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *skipError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps the error returned by Perform to stop retrying immediately, message goes straight to the dead letter topic or fallback.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// RetryAfter wraps the error returned by Perform to wait for the given delay before the next retry e.g. server provided retry-after.
+func RetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, delay: delay}
+}
+
+// Skip wraps the error returned by Perform to mark the message successful without retry and fallback.
+func Skip(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &skipError{err: err}
+}
+
+// isPermanentError returns true if the error is wrapped by Permanent.
+func isPermanentError(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// isSkipError returns true if the error is wrapped by Skip.
+func isSkipError(err error) bool {
+	var se *skipError
+	return errors.As(err, &se)
+}
+
+// retryAfterDelay returns the delay of the error wrapped by RetryAfter.
+func retryAfterDelay(err error) (time.Duration, bool) {
+	var rae *retryAfterError
+	if errors.As(err, &rae) {
+		return rae.delay, true
+	}
+	return 0, false
+}
@@ -1,24 +1,64 @@
 package tessara
 
-import "github.com/mrbryside/tessara/logger"
+import (
+	"errors"
+
+	"github.com/mrbryside/tessara/logger"
+)
+
+// errCommitGiveUp is the error of the claim that is ended because offset is not committed within commit give up time
+var errCommitGiveUp = errors.New("error commit give up")
 
 // errorHandler is an interface for handling errors
 type errorHandler interface {
 	HandleCommitGiveUp(topic string, partition int32)
 }
 
+// panicErrorHandler is an optional interface of the error handler for handling panics recovered from the message handler
+type panicErrorHandler interface {
+	HandlePanic(topic string, partition int32, err *PanicError)
+}
+
+// transactionErrorHandler is an optional interface of the error handler for handling the offset transaction error that stops the claim,
+// err wraps ErrProducerFenced when another consumer with the same transactional id has taken over the partition
+type transactionErrorHandler interface {
+	HandleTransactionError(topic string, partition int32, err error)
+}
+
 // loggingErrorHandler logs errors handler
-type loggingErrorHandler struct{}
+type loggingErrorHandler struct {
+	logger logger.Logger
+}
 
 // newLoggingErrorHandler creates a new instance of LoggingErrorHandler
-func newLoggingErrorHandler() loggingErrorHandler {
-	return loggingErrorHandler{}
+func newLoggingErrorHandler(l logger.Logger) loggingErrorHandler {
+	return loggingErrorHandler{logger: l}
 }
 
 // HandleCommitGiveUp logs the commit give up event
 func (lh loggingErrorHandler) HandleCommitGiveUp(topic string, partition int32) {
-	logger.Debug().
-		Str("topic", topic).
-		Int32("partition", partition).
-		Msg("commit give up")
+	lh.logger.Warn("commit give up",
+		"topic", topic,
+		"partition", partition,
+	)
+}
+
+// HandlePanic logs the panic recovered from the message handler
+func (lh loggingErrorHandler) HandlePanic(topic string, partition int32, err *PanicError) {
+	lh.logger.Error("panic recovered from message handler",
+		"topic", topic,
+		"partition", partition,
+		"panic", err.Value,
+		"stack", string(err.Stack),
+	)
+}
+
+// HandleTransactionError logs the offset transaction error that stops the claim
+func (lh loggingErrorHandler) HandleTransactionError(topic string, partition int32, err error) {
+	lh.logger.Error("offset transaction error",
+		"topic", topic,
+		"partition", partition,
+		"fenced", errors.Is(err, ErrProducerFenced),
+		"error", err,
+	)
 }
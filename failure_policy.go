@@ -0,0 +1,23 @@
+package tessara
+
+// FailurePolicy represents what happens to the message after the fallback is called.
+type FailurePolicy string
+
+const (
+	// FailurePolicyBlock keeps the message unmarked, watermark stalls until commit give up restarts the claim and reprocesses from the last commit.
+	FailurePolicyBlock FailurePolicy = "block"
+	// FailurePolicyMarkDone marks the message as done after the fallback, partition keeps moving (at-least-once with skip).
+	FailurePolicyMarkDone FailurePolicy = "mark_done"
+	// FailurePolicyStopPartition stops the claim of the partition with the error of the message, message is reprocessed after rebalance.
+	FailurePolicyStopPartition FailurePolicy = "stop_partition"
+)
+
+// isValid returns true if the failure policy is one of the supported policies.
+func (fp FailurePolicy) isValid() bool {
+	switch fp {
+	case FailurePolicyBlock, FailurePolicyMarkDone, FailurePolicyStopPartition:
+		return true
+	default:
+		return false
+	}
+}
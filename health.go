@@ -0,0 +1,132 @@
+package tessara
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Health represents the health of the consumer pipeline
+type Health struct {
+	// Ready is true once the consumer group session is established and partitions are assigned to the consumer
+	Ready bool `json:"ready"`
+	// Healthy is false when the consumer reports a fatal error, committer is stalled or subqueues are saturated
+	Healthy bool `json:"healthy"`
+	// Claims is the number of partitions assigned to the consumer in the current session
+	Claims int `json:"claims"`
+	// Problems describes every reason that the consumer is not healthy
+	Problems []string `json:"problems,omitempty"`
+}
+
+// healthState tracks the state of the consumer group session and the pipeline of every claimed partition
+type healthState struct {
+	mu                 sync.RWMutex
+	sessionActive      bool
+	assignedPartitions int
+	claims             map[topicPartition]*claimState
+	fatalErr           error
+	// consumerGroup is set when the consumer starts, it's used to pause and resume claimed partitions
+	consumerGroup sarama.ConsumerGroup
+
+	saturationThreshold time.Duration
+}
+
+// topicPartition identifies a claimed partition
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// claimState represents the pipeline of a claimed partition that health is checked and introspected from
+type claimState struct {
+	committer *committer
+	subqueues []*subqueue
+	paused    bool
+}
+
+// newHealthState creates a new health state, subqueue is reported as saturated when it's full longer than saturation threshold
+func newHealthState(saturationThreshold time.Duration) *healthState {
+	return &healthState{
+		claims:              make(map[topicPartition]*claimState),
+		saturationThreshold: saturationThreshold,
+	}
+}
+
+// setSession sets whether the consumer group session is established and the number of partitions assigned to the session
+func (hs *healthState) setSession(active bool, assignedPartitions int) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.sessionActive = active
+	hs.assignedPartitions = assignedPartitions
+}
+
+// setFatal records the error that consuming can not recover from
+func (hs *healthState) setFatal(err error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.fatalErr = err
+}
+
+// setConsumerGroup sets the consumer group that claimed partitions are paused and resumed on
+func (hs *healthState) setConsumerGroup(cg sarama.ConsumerGroup) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.consumerGroup = cg
+}
+
+// addClaim registers the pipeline of the claimed partition
+func (hs *healthState) addClaim(topic string, partition int32, c *claimState) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.claims[topicPartition{topic: topic, partition: partition}] = c
+}
+
+// removeClaim removes the pipeline of the partition when the claim ends
+func (hs *healthState) removeClaim(topic string, partition int32) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	delete(hs.claims, topicPartition{topic: topic, partition: partition})
+}
+
+// health returns the health of the consumer
+func (hs *healthState) health() Health {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	var problems []string
+	if hs.fatalErr != nil {
+		problems = append(problems, fmt.Sprintf("consumer group error: %v", hs.fatalErr))
+	}
+	for tp, c := range hs.claims {
+		if c.committer.isStalled() {
+			problems = append(problems, fmt.Sprintf("committer of topic %s partition %d has not advanced for longer than commit give up time", tp.topic, tp.partition))
+		}
+		for _, sq := range c.subqueues {
+			if sq.saturatedFor() > hs.saturationThreshold {
+				problems = append(problems, fmt.Sprintf("subqueue %d of topic %s partition %d is saturated for longer than %s", sq.id, tp.topic, tp.partition, hs.saturationThreshold))
+			}
+		}
+	}
+	return Health{
+		Ready:    hs.sessionActive && hs.assignedPartitions > 0,
+		Healthy:  len(problems) == 0,
+		Claims:   hs.assignedPartitions,
+		Problems: problems,
+	}
+}
+
+// healthHandler writes the health as JSON, status is 503 when the given check of the health is failed
+func healthHandler(hs *healthState, check func(Health) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := hs.health()
+		w.Header().Set("Content-Type", "application/json")
+		if !check(h) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(h)
+	})
+}
@@ -0,0 +1,53 @@
+package tessara
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthReadyOnceSessionHasClaims(t *testing.T) {
+	hs := newHealthState(time.Minute)
+	assert.Equal(t, Health{Ready: false, Healthy: true}, hs.health())
+
+	hs.setSession(true, 2)
+	assert.Equal(t, Health{Ready: true, Healthy: true, Claims: 2}, hs.health())
+
+	hs.setSession(false, 0)
+	assert.False(t, hs.health().Ready)
+}
+
+func TestHealthUnhealthyWhenSubqueueSaturated(t *testing.T) {
+	hs := newHealthState(50 * time.Millisecond)
+	hs.setSession(true, 1)
+
+	sq := &subqueue{id: 1}
+	hs.addClaim("orders", 0, &claimState{committer: &committer{memoryBuffer: &memoryBuffer{}, commitGiveUpTime: time.Hour}, subqueues: []*subqueue{sq}})
+	assert.True(t, hs.health().Healthy)
+
+	sq.saturatedSince.Store(time.Now().Add(-time.Second).UnixNano())
+	h := hs.health()
+	assert.False(t, h.Healthy)
+	assert.Len(t, h.Problems, 1)
+
+	hs.removeClaim("orders", 0)
+	assert.True(t, hs.health().Healthy)
+}
+
+func TestReadinessHandlerRespondsServiceUnavailable(t *testing.T) {
+	hs := newHealthState(time.Minute)
+	handler := healthHandler(hs, func(h Health) bool { return h.Ready && h.Healthy })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	hs.setSession(true, 1)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"ready":true,"healthy":true,"claims":1}`, rec.Body.String())
+}
@@ -6,27 +6,29 @@ import (
 	"github.com/rs/zerolog"
 )
 
-var logger zerolog.Logger
+// Logger is the logger interface of tessara, args are alternating keys and values of the structured fields.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+	// With returns a logger that includes the given fields on every log line.
+	With(args ...any) Logger
+}
+
+// Default returns the zerolog logger of tessara, it's writing to stdout only when TESSARA_ENABLE_LOG is true
+func Default() Logger {
+	return NewZerologLogger(newEnvZerolog())
+}
 
-// Init for creating a logger instance
-func Init() {
+// newEnvZerolog creates a zerolog instance that is enabled by TESSARA_ENABLE_LOG environment variable
+func newEnvZerolog() zerolog.Logger {
 	// Check the environment variable
 	enableLog := os.Getenv("TESSARA_ENABLE_LOG")
 
 	// Configure a local logger instance
 	if enableLog == "true" {
-		logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
-	} else {
-		logger = zerolog.New(nil) // Disables logging for this instance
+		return zerolog.New(os.Stdout).With().Timestamp().Logger()
 	}
-}
-
-// Debug for creating a debug event
-func Debug() *zerolog.Event {
-	return logger.Debug()
-}
-
-// Panic for creating a panic event
-func Panic() *zerolog.Event {
-	return logger.Panic()
+	return zerolog.New(nil) // Disables logging for this instance
 }
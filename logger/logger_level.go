@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the minimum level of the log lines that are passed to the underlying logger
+type Level int32
+
+// levels of the log lines
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the name of the level
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel returns the level of the given name, name is one of debug, info, warn and error
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// LevelVar is a level that can be changed at runtime, it's safe for concurrent use
+type LevelVar struct {
+	level atomic.Int32
+}
+
+// Level returns the current level
+func (lv *LevelVar) Level() Level {
+	return Level(lv.level.Load())
+}
+
+// Set sets the current level
+func (lv *LevelVar) Set(l Level) {
+	lv.level.Store(int32(l))
+}
+
+// leveledLogger drops the log lines below the level of the level var before passing them to the underlying logger
+type leveledLogger struct {
+	logger Logger
+	level  *LevelVar
+}
+
+// NewLeveledLogger creates a Logger that filters the log lines by the level var, level of the underlying logger is still applied
+// so the level var can only make the logger quieter than the underlying logger
+func NewLeveledLogger(l Logger, lv *LevelVar) Logger {
+	return leveledLogger{logger: l, level: lv}
+}
+
+// Debug logs the message at debug level
+func (ll leveledLogger) Debug(msg string, args ...any) {
+	if ll.level.Level() <= LevelDebug {
+		ll.logger.Debug(msg, args...)
+	}
+}
+
+// Info logs the message at info level
+func (ll leveledLogger) Info(msg string, args ...any) {
+	if ll.level.Level() <= LevelInfo {
+		ll.logger.Info(msg, args...)
+	}
+}
+
+// Warn logs the message at warn level
+func (ll leveledLogger) Warn(msg string, args ...any) {
+	if ll.level.Level() <= LevelWarn {
+		ll.logger.Warn(msg, args...)
+	}
+}
+
+// Error logs the message at error level
+func (ll leveledLogger) Error(msg string, args ...any) {
+	if ll.level.Level() <= LevelError {
+		ll.logger.Error(msg, args...)
+	}
+}
+
+// With returns a logger that includes the given fields on every log line
+func (ll leveledLogger) With(args ...any) Logger {
+	return leveledLogger{logger: ll.logger.With(args...), level: ll.level}
+}
@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogLogger adapts slog.Logger to Logger
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger creates a Logger that writes to the given slog logger
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{logger: l}
+}
+
+// Debug logs the message at debug level
+func (sl slogLogger) Debug(msg string, args ...any) {
+	sl.logger.Log(context.Background(), slog.LevelDebug, msg, args...)
+}
+
+// Info logs the message at info level
+func (sl slogLogger) Info(msg string, args ...any) {
+	sl.logger.Log(context.Background(), slog.LevelInfo, msg, args...)
+}
+
+// Warn logs the message at warn level
+func (sl slogLogger) Warn(msg string, args ...any) {
+	sl.logger.Log(context.Background(), slog.LevelWarn, msg, args...)
+}
+
+// Error logs the message at error level
+func (sl slogLogger) Error(msg string, args ...any) {
+	sl.logger.Log(context.Background(), slog.LevelError, msg, args...)
+}
+
+// With returns a logger that includes the given fields on every log line
+func (sl slogLogger) With(args ...any) Logger {
+	return slogLogger{logger: sl.logger.With(args...)}
+}
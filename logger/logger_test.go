@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogLoggerWritesLevelAndFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+
+	l.With("topic", "orders", "partition", int32(1)).Warn("commit give up", "offset", int64(10))
+	l.Debug("handling message")
+
+	assert.Equal(t, buf.String(), "level=WARN msg=\"commit give up\" topic=orders partition=1 offset=10\n")
+}
+
+func TestZerologLoggerWritesLevelAndFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewZerologLogger(zerolog.New(&buf).Level(zerolog.InfoLevel))
+
+	l.With("topic", "orders", "partition", int32(1)).Error("perform message failed", "offset", int64(10))
+	l.Debug("handling message")
+
+	assert.JSONEq(t, buf.String(), `{"level":"error","topic":"orders","partition":1,"offset":10,"message":"perform message failed"}`)
+}
+
+func TestLeveledLoggerFollowsLevelVar(t *testing.T) {
+	var buf bytes.Buffer
+	lv := &LevelVar{}
+	l := NewLeveledLogger(NewZerologLogger(zerolog.New(&buf)), lv).With("topic", "orders")
+
+	l.Debug("handling message")
+	lv.Set(LevelWarn)
+	l.Info("offset committed")
+	l.Warn("commit give up")
+
+	assert.Equal(t, buf.String(), "{\"level\":\"debug\",\"topic\":\"orders\",\"message\":\"handling message\"}\n{\"level\":\"warn\",\"topic\":\"orders\",\"message\":\"commit give up\"}\n")
+}
@@ -0,0 +1,38 @@
+package logger
+
+import "github.com/rs/zerolog"
+
+// zerologLogger adapts zerolog.Logger to Logger
+type zerologLogger struct {
+	logger zerolog.Logger
+}
+
+// NewZerologLogger creates a Logger that writes to the given zerolog logger
+func NewZerologLogger(l zerolog.Logger) Logger {
+	return zerologLogger{logger: l}
+}
+
+// Debug logs the message at debug level
+func (zl zerologLogger) Debug(msg string, args ...any) {
+	zl.logger.Debug().Fields(args).Msg(msg)
+}
+
+// Info logs the message at info level
+func (zl zerologLogger) Info(msg string, args ...any) {
+	zl.logger.Info().Fields(args).Msg(msg)
+}
+
+// Warn logs the message at warn level
+func (zl zerologLogger) Warn(msg string, args ...any) {
+	zl.logger.Warn().Fields(args).Msg(msg)
+}
+
+// Error logs the message at error level
+func (zl zerologLogger) Error(msg string, args ...any) {
+	zl.logger.Error().Fields(args).Msg(msg)
+}
+
+// With returns a logger that includes the given fields on every log line
+func (zl zerologLogger) With(args ...any) Logger {
+	return zerologLogger{logger: zl.logger.With().Fields(args).Logger()}
+}
@@ -19,10 +19,21 @@ type memoryBuffer struct {
 	currentBuffer   uint64
 	waterMark       uint64
 	waterMarkOffset int64
+	// waterMarkUpdatedAt is the unix nano that water mark is incremented lastly
+	waterMarkUpdatedAt atomic.Int64
+	// releaseOnCommit keeps message buffers below the water mark until they're released by the committer,
+	// it's used by transform consumer that produces outputs of the message buffers in the commit transaction
+	releaseOnCommit bool
+	releasedMark    uint64
+
+	metrics metric.PartitionMetrics
+
+	// done is closed once the water mark updater is stopped by the context
+	done chan struct{}
 }
 
 // newMemoryBuffer creates a new MemoryBuffer instance with the given buffer size.
-func newMemoryBuffer(ctx context.Context, bufferSize uint64, waterMarkUpdateBlockingInterval time.Duration, pushMessageBlockingInterval time.Duration) *memoryBuffer {
+func newMemoryBuffer(ctx context.Context, bufferSize uint64, waterMarkUpdateBlockingInterval time.Duration, pushMessageBlockingInterval time.Duration, pm metric.PartitionMetrics) *memoryBuffer {
 	mb := &memoryBuffer{
 		waterMarkUpdateBlockingInterval: waterMarkUpdateBlockingInterval,
 		pushMessageBlockingInterval:     pushMessageBlockingInterval,
@@ -31,11 +42,15 @@ func newMemoryBuffer(ctx context.Context, bufferSize uint64, waterMarkUpdateBloc
 		currentBuffer:                   0,
 		waterMark:                       0,
 		waterMarkOffset:                 -1,
+		metrics:                         pm,
+		done:                            make(chan struct{}),
 	}
+	mb.waterMarkUpdatedAt.Store(time.Now().UnixNano())
 	// set default metric
-	metric.UpdateBufferSize(bufferSize)
+	mb.metrics.UpdateBufferSize(bufferSize)
 
 	go func() {
+		defer close(mb.done)
 		mb.waterMarkUpdater(ctx)
 	}()
 	return mb
@@ -56,7 +71,7 @@ func (mb *memoryBuffer) waterMarkUpdater(ctx context.Context) {
 					mb.UpdateWaterMarkOffsetByWaterMarkMsgOffset()
 					mb.IncrementWaterMark()
 					// update metric
-					metric.IncrementCurrentWatermark()
+					mb.metrics.IncrementCurrentWatermark()
 					continue
 				}
 			}
@@ -65,14 +80,14 @@ func (mb *memoryBuffer) waterMarkUpdater(ctx context.Context) {
 	}
 }
 
-// Push pushes a new message buffer to the memory buffer.
-func (mb *memoryBuffer) Push(ctx context.Context, msgBuffer *messageBuffer) {
+// Push pushes a new message buffer to the memory buffer, it returns the context error when context is done before buffer is available.
+func (mb *memoryBuffer) Push(ctx context.Context, msgBuffer *messageBuffer) error {
 	start := time.Now()
 bufferCheckLoop:
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return ctx.Err()
 		default:
 			if mb.IsBufferAvailable() {
 				break bufferCheckLoop
@@ -86,10 +101,11 @@ bufferCheckLoop:
 	mb.IncrementCurrentBuffer()
 
 	// update current buffer metric
-	metric.IncrementCurrentBuffer()
+	mb.metrics.IncrementCurrentBuffer()
 	// update wait time metric
 	elapse := time.Since(start)
-	metric.UpdatePushToBufferWatingTime(elapse)
+	mb.metrics.ObservePushToBufferWaitingTime(elapse)
+	return nil
 }
 
 // WaterMarkOffset returns the offset of the water mark message.
@@ -114,12 +130,41 @@ func (mb *memoryBuffer) CurrentBuffer() uint64 {
 
 // IsBufferAvailable returns true if the current buffer index is greater than the water mark index.
 func (mb *memoryBuffer) IsBufferAvailable() bool {
-	return mb.CurrentBuffer()-mb.WaterMark() < mb.bufferSize
+	return mb.CurrentBuffer()-mb.releaseMark() < mb.bufferSize
 }
 
 // IsNeedToCommit returns true if the current buffer index is greater than the water mark index.
 func (mb *memoryBuffer) IsNeedToCommit() bool {
-	return mb.CurrentBuffer()-mb.WaterMark() > 0
+	return mb.CurrentBuffer()-mb.releaseMark() > 0
+}
+
+// withReleaseOnCommit keeps message buffers until they're released by Release, it has to be called before messages are pushed.
+func (mb *memoryBuffer) withReleaseOnCommit() *memoryBuffer {
+	mb.releaseOnCommit = true
+	return mb
+}
+
+// releaseMark returns the index that message buffers below it can be overwritten, it's the water mark unless release on commit is enabled.
+func (mb *memoryBuffer) releaseMark() uint64 {
+	if mb.releaseOnCommit {
+		return mb.ReleasedMark()
+	}
+	return mb.WaterMark()
+}
+
+// ReleasedMark returns the index that message buffers below it are released.
+func (mb *memoryBuffer) ReleasedMark() uint64 {
+	return atomic.LoadUint64(&mb.releasedMark)
+}
+
+// Release releases message buffers below the given index, index must not be greater than the water mark.
+func (mb *memoryBuffer) Release(mark uint64) {
+	atomic.StoreUint64(&mb.releasedMark, mark)
+}
+
+// MessageBufferAt returns the message buffer of the given index, index must be between the released mark and the water mark.
+func (mb *memoryBuffer) MessageBufferAt(index uint64) *messageBuffer {
+	return mb.messageBuffers[index%mb.bufferSize]
 }
 
 // IsWaterMarkMsgMarkSuccess check current message access index by waterMark % bufferSize and check this message in buffer is mark success or not
@@ -139,6 +184,25 @@ func (mb *memoryBuffer) UpdateWaterMarkOffsetByWaterMarkMsgOffset() {
 // IncrementWaterMark increments the water mark index.
 func (mb *memoryBuffer) IncrementWaterMark() {
 	atomic.AddUint64(&mb.waterMark, 1)
+	mb.waterMarkUpdatedAt.Store(time.Now().UnixNano())
+}
+
+// BlockingMessage returns the message buffer at the water mark that is not marked success yet and how long it's blocking the water mark,
+// it returns false if the water mark is not blocked.
+func (mb *memoryBuffer) BlockingMessage() (*messageBuffer, time.Duration, bool) {
+	// same as water mark updater, message at the water mark is only accessed when it's pushed
+	if mb.WaterMark() >= mb.CurrentBuffer() {
+		return nil, 0, false
+	}
+	messageBuffer := mb.messageBuffers[atomic.LoadUint64(&mb.waterMark)%mb.bufferSize]
+	if messageBuffer == nil || messageBuffer.IsMarkSuccess() {
+		return nil, 0, false
+	}
+	blockingSince := time.Unix(0, mb.waterMarkUpdatedAt.Load())
+	if messageBuffer.receivedAt.After(blockingSince) {
+		blockingSince = messageBuffer.receivedAt
+	}
+	return messageBuffer, time.Since(blockingSince), true
 }
 
 // IncrementCurrentBuffer increments the current buffer index.
@@ -1,11 +1,21 @@
 package tessara
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
 // messageBuffer represents a buffer for storing message offset and mark status.
 type messageBuffer struct {
 	offset        int64
 	isMarkSuccess int32
+
+	// key and received time are only used for introspection of the message that is blocking the water mark
+	key        string
+	receivedAt time.Time
+
+	// outputs are the messages returned by the transform message handler, they're set before the message buffer is marked success
+	outputs []ProducerMessage
 }
 
 // newMessageBuffer creates a new message buffer with the given offset.
@@ -13,9 +23,16 @@ func newMessageBuffer(offset int64) *messageBuffer {
 	return &messageBuffer{
 		offset:        offset,
 		isMarkSuccess: 0,
+		receivedAt:    time.Now(),
 	}
 }
 
+// withKey sets the key of the message, it has to be called before the message buffer is pushed to the memory buffer.
+func (mb *messageBuffer) withKey(key []byte) *messageBuffer {
+	mb.key = string(key)
+	return mb
+}
+
 // Offset returns the current offset of the message buffer.
 func (mb *messageBuffer) Offset() int64 {
 	return atomic.LoadInt64(&mb.offset)
@@ -30,3 +47,13 @@ func (mb *messageBuffer) MarkSuccess() {
 func (mb *messageBuffer) IsMarkSuccess() bool {
 	return atomic.LoadInt32(&mb.isMarkSuccess) == 1
 }
+
+// setOutputs sets the outputs of the transform message handler, it has to be called before the message buffer is marked success.
+func (mb *messageBuffer) setOutputs(outputs []ProducerMessage) {
+	mb.outputs = outputs
+}
+
+// Outputs returns the outputs of the transform message handler, it's only safe to call after the message buffer is marked success.
+func (mb *messageBuffer) Outputs() []ProducerMessage {
+	return mb.outputs
+}
@@ -6,10 +6,12 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/mrbryside/tessara/metric"
 )
 
 func TestMarkSuccessViaPointer(t *testing.T) {
-	mb := newMemoryBuffer(context.Background(), 10, 100*time.Millisecond, 100*time.Millisecond)
+	mb := newMemoryBuffer(context.Background(), 10, 100*time.Millisecond, 100*time.Millisecond, metric.Discard())
 
 	msgBuffer := &messageBuffer{
 		offset:        1,
@@ -22,7 +24,7 @@ func TestMarkSuccessViaPointer(t *testing.T) {
 }
 
 func TestPushMessageMoreThanBufferSize(t *testing.T) {
-	mb := newMemoryBuffer(context.Background(), 2, 100*time.Millisecond, 100*time.Millisecond)
+	mb := newMemoryBuffer(context.Background(), 2, 100*time.Millisecond, 100*time.Millisecond, metric.Discard())
 
 	msgBuffer := &messageBuffer{
 		offset:        1,
@@ -60,7 +62,7 @@ func TestPushMessageMoreThanBufferSize(t *testing.T) {
 }
 
 func TestPushMessageMoreThanBufferSizeThenMarkSuccessAfterPushAgain(t *testing.T) {
-	mb := newMemoryBuffer(context.Background(), 2, 100*time.Millisecond, 100*time.Millisecond)
+	mb := newMemoryBuffer(context.Background(), 2, 100*time.Millisecond, 100*time.Millisecond, metric.Discard())
 
 	msgBuffer := &messageBuffer{
 		offset:        1,
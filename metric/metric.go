@@ -1,209 +1,383 @@
 package metric
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-var (
-	MemoryBufferSize = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "memory_buffer_size",
-			Help: "buffer size of memory buffer",
-		},
-	)
+// partitionLabels are the labels of every metric, metrics are scoped by consumer group, topic and partition
+var partitionLabels = []string{"group", "topic", "partition"}
 
-	CurrentWaterMark = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "current_watermark",
-			Help: "current watermark of memory buffer",
-		},
-	)
+// Metrics represents the prometheus collectors of a consumer, every collector is labelled with group, topic and partition
+type Metrics struct {
+	MemoryBufferSize          *prometheus.GaugeVec
+	CurrentWaterMark          *prometheus.GaugeVec
+	CurrentBuffer             *prometheus.GaugeVec
+	PushToBufferWaitingTime   *prometheus.HistogramVec
+	SubqueueChannelBufferSize *prometheus.GaugeVec
+	SubqueueCount             *prometheus.GaugeVec
 
-	CurrentBuffer = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "current_buffer",
-			Help: "current buffer of memory buffer",
-		},
-	)
+	HighWaterMarkOffset *prometheus.GaugeVec
+	CommittedOffset     *prometheus.GaugeVec
+	WaterMarkOffset     *prometheus.GaugeVec
+	Lag                 *prometheus.GaugeVec
+	TimeSinceLastCommit *prometheus.GaugeVec
 
-	PushToBufferWatingTime = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "push_to_buffer_waiting_time_seconds",
-			Help: "wait time of messages in buffer",
-		},
-	)
+	SubqueueMessageProcessingCount     *prometheus.GaugeVec
+	SubqueueMessageProcessedCount      *prometheus.GaugeVec
+	SubqueueMessageErrorCount          *prometheus.GaugeVec
+	SubqueueMessagePermanentErrorCount *prometheus.GaugeVec
+	SubqueueMessageRetryAfterCount     *prometheus.GaugeVec
+	SubqueueMessageSkippedCount        *prometheus.GaugeVec
+	SubqueueMessagePanicCount          *prometheus.GaugeVec
+	SubqueueMessageFailureCount        *prometheus.GaugeVec
+	SubqueueMessageProcessingTime      *prometheus.HistogramVec
+}
 
-	SubqueueChannelBufferSize = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "subqueue_channel_buffer_size",
-			Help: "buffer size of subqueue channel",
-		},
-	)
+// NewMetrics creates the collectors of a consumer, namespace is prefixed to every metric name
+// and buckets are used by the waiting time and processing time histograms (default: prometheus.DefBuckets)
+func NewMetrics(namespace string, buckets []float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	subqueueLabels := append(partitionLabels[:len(partitionLabels):len(partitionLabels)], "subqueueId")
+	failureLabels := append(subqueueLabels[:len(subqueueLabels):len(subqueueLabels)], "failurePolicy")
 
-	SubqueueCount = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "subqueue_count",
-			Help: "Current number of subqueue",
-		},
-	)
+	return &Metrics{
+		MemoryBufferSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "memory_buffer_size",
+			Help:      "buffer size of memory buffer",
+		}, partitionLabels),
+		CurrentWaterMark: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "current_watermark",
+			Help:      "current watermark of memory buffer",
+		}, partitionLabels),
+		CurrentBuffer: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "current_buffer",
+			Help:      "current buffer of memory buffer",
+		}, partitionLabels),
+		PushToBufferWaitingTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "push_to_buffer_waiting_time_seconds",
+			Help:      "wait time of messages in buffer",
+			Buckets:   buckets,
+		}, partitionLabels),
+		SubqueueChannelBufferSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subqueue_channel_buffer_size",
+			Help:      "buffer size of subqueue channel",
+		}, partitionLabels),
+		SubqueueCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subqueue_count",
+			Help:      "Current number of subqueue",
+		}, partitionLabels),
+		HighWaterMarkOffset: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "high_watermark_offset",
+			Help:      "offset of the next message that will be produced to the partition",
+		}, partitionLabels),
+		CommittedOffset: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "committed_offset",
+			Help:      "offset committed to the consumer group, it's the offset of the next message to consume",
+		}, partitionLabels),
+		WaterMarkOffset: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "watermark_offset",
+			Help:      "offset of the latest contiguous message that is done in memory buffer",
+		}, partitionLabels),
+		Lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "lag",
+			Help:      "number of messages between the committed offset and the high watermark offset",
+		}, partitionLabels),
+		TimeSinceLastCommit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "time_since_last_commit_seconds",
+			Help:      "time since the last offset commit of the partition or since the partition is claimed",
+		}, partitionLabels),
+		SubqueueMessageProcessingCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subqueue_message_processing_count",
+			Help:      "Current number of subqueue message processing",
+		}, subqueueLabels),
+		SubqueueMessageProcessedCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subqueue_message_processed_count",
+			Help:      "Current number of subqueue message processed",
+		}, subqueueLabels),
+		SubqueueMessageErrorCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subqueue_message_error_count",
+			Help:      "Current number of subqueue message error",
+		}, subqueueLabels),
+		SubqueueMessagePermanentErrorCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subqueue_message_permanent_error_count",
+			Help:      "Current number of subqueue message permanent error",
+		}, subqueueLabels),
+		SubqueueMessageRetryAfterCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subqueue_message_retry_after_count",
+			Help:      "Current number of subqueue message retry with server provided delay",
+		}, subqueueLabels),
+		SubqueueMessageSkippedCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subqueue_message_skipped_count",
+			Help:      "Current number of subqueue message skipped",
+		}, subqueueLabels),
+		SubqueueMessagePanicCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subqueue_message_panic_count",
+			Help:      "Current number of subqueue message panic recovered",
+		}, subqueueLabels),
+		SubqueueMessageFailureCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subqueue_message_failure_count",
+			Help:      "Current number of subqueue message failed after fallback by failure policy",
+		}, failureLabels),
+		SubqueueMessageProcessingTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "subqueue_message_processing_time_seconds",
+			Help:      "processing time of messages in subqueue",
+			Buckets:   buckets,
+		}, partitionLabels),
+	}
+}
 
-	SubqueueMessageProcessingCount = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "subqueue_message_processing_count",
-			Help: "Current number of subqueue message processing",
-		},
-		[]string{"subqueueId"}, // label to differentiate queues
-	)
+// Register registers every collector to the registerer, collector that is already registered by another consumer
+// with the same namespace is reused so consumers in one process are sharing the metric families
+func (m *Metrics) Register(reg prometheus.Registerer) error {
+	var errs []error
+	for _, gv := range []**prometheus.GaugeVec{
+		&m.MemoryBufferSize,
+		&m.CurrentWaterMark,
+		&m.CurrentBuffer,
+		&m.SubqueueChannelBufferSize,
+		&m.SubqueueCount,
+		&m.HighWaterMarkOffset,
+		&m.CommittedOffset,
+		&m.WaterMarkOffset,
+		&m.Lag,
+		&m.TimeSinceLastCommit,
+		&m.SubqueueMessageProcessingCount,
+		&m.SubqueueMessageProcessedCount,
+		&m.SubqueueMessageErrorCount,
+		&m.SubqueueMessagePermanentErrorCount,
+		&m.SubqueueMessageRetryAfterCount,
+		&m.SubqueueMessageSkippedCount,
+		&m.SubqueueMessagePanicCount,
+		&m.SubqueueMessageFailureCount,
+	} {
+		errs = append(errs, register(reg, gv))
+	}
+	for _, hv := range []**prometheus.HistogramVec{
+		&m.PushToBufferWaitingTime,
+		&m.SubqueueMessageProcessingTime,
+	} {
+		errs = append(errs, register(reg, hv))
+	}
+	return errors.Join(errs...)
+}
 
-	SubqueueMessageProcessedCount = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "subqueue_message_processed_count",
-			Help: "Current number of subqueue message processed",
-		},
-		[]string{"subqueueId"}, // label to differentiate queues
-	)
+// register registers the collector, collector is replaced by the existing one if it's already registered
+func register[T prometheus.Collector](reg prometheus.Registerer, c *T) error {
+	err := reg.Register(*c)
+	if err == nil {
+		return nil
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			*c = existing
+			return nil
+		}
+	}
+	return err
+}
 
-	SubqueueMessageErrorCount = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "subqueue_message_error_count",
-			Help: "Current number of subqueue message error",
+// Partition returns the metrics of a claimed partition of the consumer group
+func (m *Metrics) Partition(group, topic string, partition int32) PartitionMetrics {
+	return PartitionMetrics{
+		metrics: m,
+		labels: prometheus.Labels{
+			"group":     group,
+			"topic":     topic,
+			"partition": fmt.Sprintf("%d", partition),
 		},
-		[]string{"subqueueId"}, // label to differentiate queues
-	)
+	}
+}
 
-	SubqueueMessageProcessingTime = prometheus.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "subqueue_message_processing_time_seconds",
-			Help: "processing time of messages in subqueue",
-		},
-	)
-)
+// PartitionMetrics represents the metrics of a claimed partition
+type PartitionMetrics struct {
+	metrics *Metrics
+	labels  prometheus.Labels
+}
+
+// Delete removes the gauges of the partition when the claim ends, histograms are kept because we need old stat when claim is reassigned
+func (pm PartitionMetrics) Delete() {
+	for _, gv := range []*prometheus.GaugeVec{
+		pm.metrics.MemoryBufferSize,
+		pm.metrics.CurrentWaterMark,
+		pm.metrics.CurrentBuffer,
+		pm.metrics.SubqueueChannelBufferSize,
+		pm.metrics.SubqueueCount,
+		pm.metrics.HighWaterMarkOffset,
+		pm.metrics.CommittedOffset,
+		pm.metrics.WaterMarkOffset,
+		pm.metrics.Lag,
+		pm.metrics.TimeSinceLastCommit,
+		pm.metrics.SubqueueMessageProcessingCount,
+		pm.metrics.SubqueueMessageProcessedCount,
+		pm.metrics.SubqueueMessageErrorCount,
+		pm.metrics.SubqueueMessagePermanentErrorCount,
+		pm.metrics.SubqueueMessageRetryAfterCount,
+		pm.metrics.SubqueueMessageSkippedCount,
+		pm.metrics.SubqueueMessagePanicCount,
+		pm.metrics.SubqueueMessageFailureCount,
+	} {
+		gv.DeletePartialMatch(pm.labels)
+	}
+}
 
-func ClearMetrics() {
-	// do not clear current water mark, currentBuffer because it's will be zero forever if it's not updated
-	// and do not clear SubqueueMessageProcessingTime, PushToBufferWatingTime because we need old stat when session reset
-	CurrentWaterMark.Set(0)
-	CurrentBuffer.Set(0)
-	MemoryBufferSize.Set(0)
-	PushToBufferWatingTime.Set(0)
-	SubqueueMessageProcessingTime.Set(0)
-	SubqueueCount.Set(0)
-	SubqueueChannelBufferSize.Set(0)
-	SubqueueMessageProcessingCount.Reset()
-	SubqueueMessageProcessedCount.Reset()
-	SubqueueMessageErrorCount.Reset()
+// subqueueLabels returns the labels of the subqueue of the partition
+func (pm PartitionMetrics) subqueueLabels(subqueueId int) prometheus.Labels {
+	labels := prometheus.Labels{"subqueueId": fmt.Sprintf("%d", subqueueId)}
+	for k, v := range pm.labels {
+		labels[k] = v
+	}
+	return labels
 }
 
 // UpdateBufferSize updates the size of the memory buffer.
-func UpdateBufferSize(bufferSize uint64) {
-	go func() {
-		MemoryBufferSize.Set(float64(bufferSize))
-	}()
+func (pm PartitionMetrics) UpdateBufferSize(bufferSize uint64) {
+	pm.metrics.MemoryBufferSize.With(pm.labels).Set(float64(bufferSize))
 }
 
 // IncrementCurrentWatermark increments the current watermark.
-func IncrementCurrentWatermark() {
-	go func() {
-		CurrentWaterMark.Inc()
-	}()
+func (pm PartitionMetrics) IncrementCurrentWatermark() {
+	pm.metrics.CurrentWaterMark.With(pm.labels).Inc()
 }
 
 // UpdateCurrentBuffer updates the current buffer size.
-func UpdateCurrentBuffer(buffer uint64) {
-	go func() {
-		CurrentBuffer.Set(float64(buffer))
-	}()
+func (pm PartitionMetrics) UpdateCurrentBuffer(buffer uint64) {
+	pm.metrics.CurrentBuffer.With(pm.labels).Set(float64(buffer))
 }
 
 // IncrementCurrentBuffer increments the current buffer size.
-func IncrementCurrentBuffer() {
-	go func() {
-		CurrentBuffer.Inc()
-	}()
+func (pm PartitionMetrics) IncrementCurrentBuffer() {
+	pm.metrics.CurrentBuffer.With(pm.labels).Inc()
 }
 
-// UpdatePushToBufferWatingTime updates the waiting time for pushing to buffer.
-func UpdatePushToBufferWatingTime(elapse time.Duration) {
-	go func() {
-		PushToBufferWatingTime.Set(elapse.Seconds())
-	}()
+// ObservePushToBufferWaitingTime observes the waiting time for pushing to buffer.
+func (pm PartitionMetrics) ObservePushToBufferWaitingTime(elapse time.Duration) {
+	pm.metrics.PushToBufferWaitingTime.With(pm.labels).Observe(elapse.Seconds())
 }
 
-func UpdateSubqueueChannelBufferSize(bufferSize uint64) {
-	go func() {
-		SubqueueChannelBufferSize.Set(float64(bufferSize))
-	}()
+// UpdateSubqueueChannelBufferSize updates the buffer size of subqueue channel.
+func (pm PartitionMetrics) UpdateSubqueueChannelBufferSize(bufferSize uint64) {
+	pm.metrics.SubqueueChannelBufferSize.With(pm.labels).Set(float64(bufferSize))
 }
 
-// InitSubqueueMessageProcessingCount initializes the subqueue message processing count.
-func InitSubqueueMessageProcessingCount(subqueueId int) {
-	go func() {
-		SubqueueMessageProcessingCount.WithLabelValues(fmt.Sprintf("%d", subqueueId)).Set(0)
-	}()
+// SetSubqueueCount sets the subqueue count.
+func (pm PartitionMetrics) SetSubqueueCount(count int) {
+	pm.metrics.SubqueueCount.With(pm.labels).Set(float64(count))
+}
+
+// UpdateOffsets updates the high watermark, committed and memory buffer watermark offsets of the partition,
+// lag is only updated when the committed offset is known.
+func (pm PartitionMetrics) UpdateOffsets(highWaterMarkOffset, committedOffset, waterMarkOffset int64) {
+	pm.metrics.HighWaterMarkOffset.With(pm.labels).Set(float64(highWaterMarkOffset))
+	pm.metrics.WaterMarkOffset.With(pm.labels).Set(float64(waterMarkOffset))
+	if committedOffset < 0 {
+		return
+	}
+	pm.metrics.CommittedOffset.With(pm.labels).Set(float64(committedOffset))
+	pm.metrics.Lag.With(pm.labels).Set(float64(max(highWaterMarkOffset-committedOffset, 0)))
+}
+
+// UpdateTimeSinceLastCommit updates the time since the last commit.
+func (pm PartitionMetrics) UpdateTimeSinceLastCommit(elapse time.Duration) {
+	pm.metrics.TimeSinceLastCommit.With(pm.labels).Set(elapse.Seconds())
+}
+
+// InitSubqueue initializes every count of the subqueue.
+func (pm PartitionMetrics) InitSubqueue(subqueueId int, failurePolicy string) {
+	labels := pm.subqueueLabels(subqueueId)
+	pm.metrics.SubqueueMessageProcessingCount.With(labels).Set(0)
+	pm.metrics.SubqueueMessageProcessedCount.With(labels).Set(0)
+	pm.metrics.SubqueueMessageErrorCount.With(labels).Set(0)
+	pm.metrics.SubqueueMessagePermanentErrorCount.With(labels).Set(0)
+	pm.metrics.SubqueueMessageRetryAfterCount.With(labels).Set(0)
+	pm.metrics.SubqueueMessageSkippedCount.With(labels).Set(0)
+	pm.metrics.SubqueueMessagePanicCount.With(labels).Set(0)
+	labels["failurePolicy"] = failurePolicy
+	pm.metrics.SubqueueMessageFailureCount.With(labels).Set(0)
 }
 
 // IncrementSubqueueMessageProcessingCount increments the subqueue message processing count.
-func IncrementSubqueueMessageProcessingCount(subqueueId int) {
-	go func() {
-		SubqueueMessageProcessingCount.WithLabelValues(fmt.Sprintf("%d", subqueueId)).Inc()
-	}()
+func (pm PartitionMetrics) IncrementSubqueueMessageProcessingCount(subqueueId int) {
+	pm.metrics.SubqueueMessageProcessingCount.With(pm.subqueueLabels(subqueueId)).Inc()
 }
 
 // DecrementSubqueueMessageProcessingCount decrements the subqueue message processing count.
-func DecrementSubqueueMessageProcessingCount(subqueueId int) {
-	go func() {
-		SubqueueMessageProcessingCount.WithLabelValues(fmt.Sprintf("%d", subqueueId)).Dec()
-	}()
+func (pm PartitionMetrics) DecrementSubqueueMessageProcessingCount(subqueueId int) {
+	pm.metrics.SubqueueMessageProcessingCount.With(pm.subqueueLabels(subqueueId)).Dec()
 }
 
-// InitSubqueueMessageProcessedCount initializes the subqueue message processed count.
-func InitSubqueueMessageProcessedCount(subqueueId int) {
-	go func() {
-		SubqueueMessageProcessedCount.WithLabelValues(fmt.Sprintf("%d", subqueueId)).Set(0)
-	}()
+// IncrementSubqueueMessageProcessedCount increments the subqueue message processed count.
+func (pm PartitionMetrics) IncrementSubqueueMessageProcessedCount(subqueueId int) {
+	pm.metrics.SubqueueMessageProcessedCount.With(pm.subqueueLabels(subqueueId)).Inc()
 }
 
-// IncrementSubqueueMessageProcessedCount increments the subqueue message processed count.
-func IncrementSubqueueMessageProcessedCount(subqueueId int) {
-	go func() {
-		SubqueueMessageProcessedCount.WithLabelValues(fmt.Sprintf("%d", subqueueId)).Inc()
-	}()
+// IncrementSubqueueMessageErrorCount increments the subqueue message error count.
+func (pm PartitionMetrics) IncrementSubqueueMessageErrorCount(subqueueId int) {
+	pm.metrics.SubqueueMessageErrorCount.With(pm.subqueueLabels(subqueueId)).Inc()
 }
 
-// SetSubqueueCount sets the subqueue count.
-func SetSubqueueCount(count int) {
-	go func() {
-		SubqueueCount.Set(float64(count))
-	}()
+// IncrementSubqueueMessagePermanentErrorCount increments the subqueue message permanent error count.
+func (pm PartitionMetrics) IncrementSubqueueMessagePermanentErrorCount(subqueueId int) {
+	pm.metrics.SubqueueMessagePermanentErrorCount.With(pm.subqueueLabels(subqueueId)).Inc()
 }
 
-// InitSubqueueMessageErrorCount initializes the subqueue message error count.
-func InitSubqueueMessageErrorCount(subqueueId int) {
-	go func() {
-		SubqueueMessageErrorCount.WithLabelValues(fmt.Sprintf("%d", subqueueId)).Set(0)
-	}()
+// IncrementSubqueueMessageRetryAfterCount increments the subqueue message retry after count.
+func (pm PartitionMetrics) IncrementSubqueueMessageRetryAfterCount(subqueueId int) {
+	pm.metrics.SubqueueMessageRetryAfterCount.With(pm.subqueueLabels(subqueueId)).Inc()
 }
 
-// IncrementSubqueueMessageErrorCount increments the subqueue message error count.
-func IncrementSubqueueMessageErrorCount(subqueueId int) {
-	go func() {
-		SubqueueMessageErrorCount.WithLabelValues(fmt.Sprintf("%d", subqueueId)).Inc()
-	}()
+// IncrementSubqueueMessageSkippedCount increments the subqueue message skipped count.
+func (pm PartitionMetrics) IncrementSubqueueMessageSkippedCount(subqueueId int) {
+	pm.metrics.SubqueueMessageSkippedCount.With(pm.subqueueLabels(subqueueId)).Inc()
+}
+
+// IncrementSubqueueMessagePanicCount increments the subqueue message panic count.
+func (pm PartitionMetrics) IncrementSubqueueMessagePanicCount(subqueueId int) {
+	pm.metrics.SubqueueMessagePanicCount.With(pm.subqueueLabels(subqueueId)).Inc()
+}
+
+// IncrementSubqueueMessageFailureCount increments the subqueue message failure count of the failure policy.
+func (pm PartitionMetrics) IncrementSubqueueMessageFailureCount(subqueueId int, failurePolicy string) {
+	labels := pm.subqueueLabels(subqueueId)
+	labels["failurePolicy"] = failurePolicy
+	pm.metrics.SubqueueMessageFailureCount.With(labels).Inc()
 }
 
-// DecrementSubqueueMessageErrorCount decrements the subqueue message error count.
-func DecrementSubqueueMessageErrorCount(subqueueId int) {
-	go func() {
-		SubqueueMessageErrorCount.WithLabelValues(fmt.Sprintf("%d", subqueueId)).Dec()
-	}()
+// ObserveSubqueueMessageProcessingTime observes the subqueue message processing time.
+func (pm PartitionMetrics) ObserveSubqueueMessageProcessingTime(elapse time.Duration) {
+	pm.metrics.SubqueueMessageProcessingTime.With(pm.labels).Observe(elapse.Seconds())
 }
 
-// UpdateSubqueueMessageProcessingTime sets the subqueue message processing time.
-func UpdateSubqueueMessageProcessingTime(elapse time.Duration) {
-	go func() {
-		SubqueueMessageProcessingTime.Set(elapse.Seconds())
-	}()
+// discardMetrics is never registered, it's used by the pipeline that is not running under a consumer
+var discardMetrics = NewMetrics("", nil)
+
+// Discard returns the metrics of a partition that are not registered to any registerer
+func Discard() PartitionMetrics {
+	return discardMetrics.Partition("", "", 0)
 }
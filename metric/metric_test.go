@@ -0,0 +1,50 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsSharedByConsumersOfSameRegisterer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	orders := NewMetrics("app", nil)
+	payments := NewMetrics("app", nil)
+	assert.NoError(t, orders.Register(reg))
+	assert.NoError(t, payments.Register(reg))
+
+	orders.Partition("orders-group", "orders", 0).UpdateBufferSize(256)
+	payments.Partition("payments-group", "payments", 0).UpdateBufferSize(128)
+
+	assert.Equal(t, testutil.CollectAndCount(orders.MemoryBufferSize, "app_memory_buffer_size"), 2)
+}
+
+func TestDeletePartitionKeepsOtherPartitions(t *testing.T) {
+	m := NewMetrics("", []float64{0.1, 1})
+	p0 := m.Partition("orders-group", "orders", 0)
+	p1 := m.Partition("orders-group", "orders", 1)
+	p0.InitSubqueue(1, "block")
+	p1.InitSubqueue(1, "block")
+	p0.ObserveSubqueueMessageProcessingTime(50 * time.Millisecond)
+
+	p0.Delete()
+
+	assert.Equal(t, testutil.CollectAndCount(m.SubqueueMessageProcessedCount), 1)
+	assert.Equal(t, testutil.ToFloat64(m.SubqueueMessageProcessedCount.WithLabelValues("orders-group", "orders", "1", "1")), float64(0))
+	assert.Equal(t, testutil.CollectAndCount(m.SubqueueMessageProcessingTime), 1)
+}
+
+func TestUpdateOffsetsSetsLag(t *testing.T) {
+	m := NewMetrics("", nil)
+	p := m.Partition("orders-group", "orders", 0)
+
+	p.UpdateOffsets(100, -1, 10)
+	assert.Equal(t, testutil.CollectAndCount(m.Lag), 0)
+
+	p.UpdateOffsets(100, 40, 45)
+	assert.Equal(t, testutil.ToFloat64(m.Lag.WithLabelValues("orders-group", "orders", "0")), float64(60))
+	assert.Equal(t, testutil.ToFloat64(m.WaterMarkOffset.WithLabelValues("orders-group", "orders", "0")), float64(45))
+}
@@ -13,8 +13,12 @@ type orchestrator struct {
 	memoryBuffer      *memoryBuffer
 	subqueueQualifier *subqueueQualifier
 	committer         *committer
+	tracer            messageTracer
 
 	pushMessageBlockingInterval time.Duration
+
+	// done is closed once the orchestrator is stopped by the context
+	done chan struct{}
 }
 
 // newOrchestrator creates a new orchestrator instance.
@@ -23,6 +27,7 @@ func newOrchestrator(
 	mb *memoryBuffer,
 	sq *subqueueQualifier,
 	cm *committer,
+	mt messageTracer,
 	memoryBufferSize uint64,
 	pushMessageBlockingInterval time.Duration,
 ) *orchestrator {
@@ -32,9 +37,12 @@ func newOrchestrator(
 		memoryBuffer:                mb,
 		subqueueQualifier:           sq,
 		committer:                   cm,
+		tracer:                      mt,
 		pushMessageBlockingInterval: pushMessageBlockingInterval,
+		done:                        make(chan struct{}),
 	}
 	go func() {
+		defer close(o.done)
 		o.startReceive(ctx)
 	}()
 
@@ -65,17 +73,27 @@ func (o *orchestrator) startReceive(ctx context.Context) {
 			if !ok {
 				return
 			}
-			msb := newMessageBuffer(msg.Offset)
+			msb := newMessageBuffer(msg.Offset).withKey(msg.Key)
+			trace := o.tracer.startMessage(msg)
 
 			// push to memory buffer, this may block if buffer is full
 			// once committer commit some messages this will unblock
-			o.memoryBuffer.Push(ctx, msb)
+			if err := o.memoryBuffer.Push(ctx, msb); err != nil {
+				// claim is ended while waiting for the buffer, spans of the message are ended with the context error
+				trace.cancel(err)
+				return
+			}
 
 			// push to subqueue qualifier after memory buffer push success
-			o.subqueueQualifier.Push(ctx, subqueueMessage{
+			trace = trace.startSubqueueWait()
+			if err := o.subqueueQualifier.Push(ctx, subqueueMessage{
 				consumerMessage: msg,
 				messageBuffer:   msb,
-			})
+				trace:           trace,
+			}); err != nil {
+				trace.cancel(err)
+				return
+			}
 		}
 	}
 }
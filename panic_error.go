@@ -0,0 +1,22 @@
+package tessara
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError represents a panic recovered from the message handler, it's treated as a regular error of the perform attempt.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+// Error returns the recovered value with the stack trace of the panic.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic recovered: %v\n%s", e.Value, e.Stack)
+}
+
+// newPanicError creates a panic error of the recovered value with the current stack trace.
+func newPanicError(value any) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
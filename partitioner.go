@@ -0,0 +1,238 @@
+package tessara
+
+import (
+	"math/rand/v2"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/twmb/murmur3"
+)
+
+// stickyBatchSize is the number of keyless messages that sticky partitioner sends to a partition before it switches to another
+const stickyBatchSize = 100
+
+// partitioner selects the partition of the messages that are not produced to an explicit partition.
+type partitioner struct {
+	constructor sarama.PartitionerConstructor
+}
+
+// NewMurmur3Partitioner creates the partitioner that hashes keys with murmur3, keyless messages are sent to random partitions.
+// it's the default partitioner of tessara.
+func NewMurmur3Partitioner() partitioner {
+	return partitioner{constructor: sarama.NewCustomHashPartitioner(murmur3.New32)}
+}
+
+// NewMurmur2Partitioner creates the partitioner that hashes keys the same way as the default partitioner of the Java client,
+// keyless messages are sent to random partitions.
+func NewMurmur2Partitioner() partitioner {
+	return partitioner{constructor: func(topic string) sarama.Partitioner {
+		return murmur2Partitioner{random: sarama.NewRandomPartitioner(topic)}
+	}}
+}
+
+// NewCRC32Partitioner creates the partitioner that hashes keys with CRC32 the same way as the consistent_random partitioner of librdkafka,
+// keyless messages are sent to random partitions.
+func NewCRC32Partitioner() partitioner {
+	return partitioner{constructor: sarama.NewConsistentCRCHashPartitioner}
+}
+
+// NewRoundRobinPartitioner creates the partitioner that sends messages to partitions in turn regardless of the key.
+func NewRoundRobinPartitioner() partitioner {
+	return partitioner{constructor: sarama.NewRoundRobinPartitioner}
+}
+
+// NewStickyPartitioner creates the partitioner that hashes keys with murmur2 like the Java client, keyless messages stick to a random partition
+// and switch to another one after every sticky batch so they are batched together.
+func NewStickyPartitioner() partitioner {
+	return partitioner{constructor: func(topic string) sarama.Partitioner {
+		return &stickyPartitioner{current: -1}
+	}}
+}
+
+// NewCustomPartitioner creates the partitioner that selects the partition by the given function, key is nil for keyless messages
+// and the returned partition must be in the range of number of partitions.
+func NewCustomPartitioner(fn func(key []byte, numPartitions int32) int32) partitioner {
+	return partitioner{constructor: func(topic string) sarama.Partitioner {
+		return customPartitioner{fn: fn}
+	}}
+}
+
+// explicitPartitionConstructor wraps the partitioner so the explicit partition of the producer message takes effect.
+func (p partitioner) explicitPartitionConstructor() sarama.PartitionerConstructor {
+	return func(topic string) sarama.Partitioner {
+		return explicitPartitioner{Partitioner: p.constructor(topic)}
+	}
+}
+
+// explicitPartitioner returns the explicit partition of the producer message if it's set, otherwise it delegates to the partitioner.
+type explicitPartitioner struct {
+	sarama.Partitioner
+}
+
+// Partition returns the partition of the message.
+func (p explicitPartitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if md, ok := message.Metadata.(messageMetadata); ok && md.partition != nil {
+		if *md.partition < 0 || *md.partition >= numPartitions {
+			return -1, sarama.ErrInvalidPartition
+		}
+		return *md.partition, nil
+	}
+	return p.Partitioner.Partition(message, numPartitions)
+}
+
+// MessageRequiresConsistency returns true for the message of explicit partition, otherwise it follows the partitioner.
+func (p explicitPartitioner) MessageRequiresConsistency(message *sarama.ProducerMessage) bool {
+	if md, ok := message.Metadata.(messageMetadata); ok && md.partition != nil {
+		return true
+	}
+	if dp, ok := p.Partitioner.(sarama.DynamicConsistencyPartitioner); ok {
+		return dp.MessageRequiresConsistency(message)
+	}
+	return p.Partitioner.RequiresConsistency()
+}
+
+// murmur2Partitioner hashes keys with murmur2 like the Java client.
+type murmur2Partitioner struct {
+	random sarama.Partitioner
+}
+
+// Partition returns the partition of the message.
+func (p murmur2Partitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if message.Key == nil {
+		return p.random.Partition(message, numPartitions)
+	}
+	key, err := message.Key.Encode()
+	if err != nil {
+		return -1, err
+	}
+	return murmur2Partition(key, numPartitions), nil
+}
+
+// RequiresConsistency returns true because keys are hashed to the same partition.
+func (p murmur2Partitioner) RequiresConsistency() bool {
+	return true
+}
+
+// MessageRequiresConsistency returns true only for the message with key.
+func (p murmur2Partitioner) MessageRequiresConsistency(message *sarama.ProducerMessage) bool {
+	return message.Key != nil
+}
+
+// stickyPartitioner sends keyless messages to the same partition until the sticky batch is full.
+type stickyPartitioner struct {
+	mu      sync.Mutex
+	current int32
+	sent    int
+}
+
+// Partition returns the partition of the message.
+func (p *stickyPartitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if message.Key != nil {
+		key, err := message.Key.Encode()
+		if err != nil {
+			return -1, err
+		}
+		return murmur2Partition(key, numPartitions), nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current < 0 || p.current >= numPartitions || p.sent >= stickyBatchSize {
+		p.current = p.next(numPartitions)
+		p.sent = 0
+	}
+	p.sent++
+	return p.current, nil
+}
+
+// next returns a random partition that is different from the current one when there is more than one partition.
+func (p *stickyPartitioner) next(numPartitions int32) int32 {
+	if numPartitions == 1 {
+		return 0
+	}
+	for {
+		partition := rand.Int32N(numPartitions)
+		if partition != p.current {
+			return partition
+		}
+	}
+}
+
+// RequiresConsistency returns true because keys are hashed to the same partition.
+func (p *stickyPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+// MessageRequiresConsistency returns true only for the message with key.
+func (p *stickyPartitioner) MessageRequiresConsistency(message *sarama.ProducerMessage) bool {
+	return message.Key != nil
+}
+
+// customPartitioner selects the partition by the function of the user.
+type customPartitioner struct {
+	fn func(key []byte, numPartitions int32) int32
+}
+
+// Partition returns the partition of the message.
+func (p customPartitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	var key []byte
+	if message.Key != nil {
+		var err error
+		if key, err = message.Key.Encode(); err != nil {
+			return -1, err
+		}
+	}
+	partition := p.fn(key, numPartitions)
+	if partition < 0 || partition >= numPartitions {
+		return -1, sarama.ErrInvalidPartition
+	}
+	return partition, nil
+}
+
+// RequiresConsistency returns true because the function is expected to be deterministic.
+func (p customPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+// murmur2Partition returns the partition of the key the same way as the default partitioner of the Java client.
+func murmur2Partition(key []byte, numPartitions int32) int32 {
+	return int32(murmur2(key)&0x7fffffff) % numPartitions
+}
+
+// murmur2 is the 32 bit murmur2 hash of the Java client with its seed.
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
@@ -0,0 +1,57 @@
+package tessara
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMurmur2MatchesJavaClient(t *testing.T) {
+	// expected hashes are taken from the murmur2 test of the Java client
+	cases := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	for key, expected := range cases {
+		assert.Equal(t, expected, int32(murmur2([]byte(key))), key)
+	}
+}
+
+func TestExplicitPartitionTakesEffect(t *testing.T) {
+	p := NewMurmur2Partitioner().explicitPartitionConstructor()("orders")
+	partition := int32(5)
+
+	got, err := p.Partition(toSaramaProducerMessage(ProducerMessage{Topic: "orders", Key: "order-1", Partition: &partition}), 6)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), got)
+
+	_, err = p.Partition(toSaramaProducerMessage(ProducerMessage{Topic: "orders", Key: "order-1", Partition: &partition}), 3)
+	assert.ErrorIs(t, err, sarama.ErrInvalidPartition)
+
+	got, err = p.Partition(toSaramaProducerMessage(ProducerMessage{Topic: "orders", Key: "order-1"}), 6)
+	assert.NoError(t, err)
+	assert.Equal(t, murmur2Partition([]byte("order-1"), 6), got)
+}
+
+func TestEmptyKeyIsNilKey(t *testing.T) {
+	assert.Nil(t, toSaramaProducerMessage(ProducerMessage{Topic: "orders"}).Key)
+	assert.NotNil(t, toSaramaProducerMessage(ProducerMessage{Topic: "orders", Key: "order-1"}).Key)
+}
+
+func TestStickyPartitionerSticksKeylessMessages(t *testing.T) {
+	p := NewStickyPartitioner().constructor("orders")
+
+	first, err := p.Partition(&sarama.ProducerMessage{Topic: "orders"}, 6)
+	assert.NoError(t, err)
+	for range stickyBatchSize - 1 {
+		got, _ := p.Partition(&sarama.ProducerMessage{Topic: "orders"}, 6)
+		assert.Equal(t, first, got)
+	}
+	next, _ := p.Partition(&sarama.ProducerMessage{Topic: "orders"}, 6)
+	assert.NotEqual(t, first, next)
+}
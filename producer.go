@@ -1,11 +1,13 @@
 package tessara
 
+import "github.com/IBM/sarama"
+
 // ProducerMessage represents a message to be produced by a producer.
 type ProducerMessage struct {
 	Topic     string
-	Partition *int32
+	Partition *int32 // explicit partition of the message, partitioner is used when it's nil
 	Key       string
-	Headers   []Header
+	Headers   Headers
 	Value     []byte
 
 	MetricLabelKeyType string
@@ -16,3 +18,84 @@ type Header struct {
 	Key   string
 	Value []byte
 }
+
+// Headers represents the headers of a message, the same key can be included more than once.
+type Headers []Header
+
+// Get returns the value of the first header with the given key.
+func (hs Headers) Get(key string) ([]byte, bool) {
+	for _, h := range hs {
+		if h.Key == key {
+			return h.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Values returns the values of every header with the given key.
+func (hs Headers) Values(key string) [][]byte {
+	var values [][]byte
+	for _, h := range hs {
+		if h.Key == key {
+			values = append(values, h.Value)
+		}
+	}
+	return values
+}
+
+// Has returns true if a header with the given key is included.
+func (hs Headers) Has(key string) bool {
+	_, ok := hs.Get(key)
+	return ok
+}
+
+// toSaramaHeaders converts headers to sarama record headers for producing.
+func toSaramaHeaders(hs Headers) []sarama.RecordHeader {
+	var headers []sarama.RecordHeader
+	for _, header := range hs {
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(header.Key),
+			Value: header.Value,
+		})
+	}
+	return headers
+}
+
+// fromSaramaHeaders converts sarama record headers of a consumed message to headers.
+func fromSaramaHeaders(rhs []*sarama.RecordHeader) Headers {
+	var headers Headers
+	for _, rh := range rhs {
+		if rh == nil {
+			continue
+		}
+		headers = append(headers, Header{
+			Key:   string(rh.Key),
+			Value: rh.Value,
+		})
+	}
+	return headers
+}
+
+// messageMetadata is carried by the sarama producer message, explicit partition is read by the partitioner
+// and delivery is only set by the async producer.
+type messageMetadata struct {
+	partition *int32
+	delivery  *asyncDelivery
+}
+
+// toSaramaProducerMessage converts the producer message to the sarama producer message, empty key is converted to nil key.
+func toSaramaProducerMessage(pm ProducerMessage) *sarama.ProducerMessage {
+	sPm := &sarama.ProducerMessage{
+		Topic:    pm.Topic,
+		Value:    sarama.StringEncoder(pm.Value),
+		Headers:  toSaramaHeaders(pm.Headers),
+		Metadata: messageMetadata{partition: pm.Partition},
+	}
+	if pm.Key != "" {
+		sPm.Key = sarama.StringEncoder(pm.Key)
+	}
+	if pm.Partition != nil {
+		sPm.Partition = *pm.Partition
+	}
+	return sPm
+}
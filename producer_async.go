@@ -0,0 +1,238 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mrbryside/tessara/logger"
+)
+
+// ErrProducerClosed is returned when a message is produced after the producer is closed.
+var ErrProducerClosed = errors.New("producer is closed")
+
+// ProducerResult represents the delivery result of a message produced by the async producer.
+type ProducerResult struct {
+	Message   ProducerMessage
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+// asyncDelivery is carried by the metadata of the sarama message until the delivery result is returned.
+type asyncDelivery struct {
+	message  ProducerMessage
+	callback func(ProducerResult)
+	span     trace.Span
+}
+
+// asyncProducer represents an asynchronous producer that batches messages by linger time and batch size.
+type asyncProducer struct {
+	Producer sarama.AsyncProducer
+	logger   logger.Logger
+	tracer   messageTracer
+
+	// results receives the delivery result of every message, it's nil when results channel is disabled
+	results chan ProducerResult
+
+	// mu guards closed, produce holds read lock while sending to the input channel so close waits for it
+	mu       sync.RWMutex
+	closed   bool
+	inflight inflightCounter
+	// dispatched is closed once every delivery result is dispatched after the sarama producer is closed
+	dispatched chan struct{}
+}
+
+// NewAsyncProducer creates a new asynchronous producer instance, it returns error if the config is invalid or brokers are unreachable.
+func NewAsyncProducer(config producerConfig) (*asyncProducer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	producer, err := sarama.NewAsyncProducer(config.brokers, config.ToSaramaConfig().Config())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create async producer instance: %w", err)
+	}
+	return newAsyncProducer(producer, config.logger, newMessageTracer(config.tracerProvider, ""), config.resultsBufferSize), nil
+}
+
+// newAsyncProducer creates the async producer of the sarama producer and starts dispatching delivery results.
+func newAsyncProducer(p sarama.AsyncProducer, l logger.Logger, t messageTracer, resultsBufferSize int) *asyncProducer {
+	ap := &asyncProducer{
+		Producer:   p,
+		logger:     l,
+		tracer:     t,
+		dispatched: make(chan struct{}),
+	}
+	if resultsBufferSize > 0 {
+		ap.results = make(chan ProducerResult, resultsBufferSize)
+	}
+
+	go func() {
+		ap.startDispatch()
+	}()
+
+	return ap
+}
+
+// Results returns the channel of the delivery results, it's nil if results channel is not enabled by producer config.
+// channel is closed once the producer is closed.
+func (ap *asyncProducer) Results() <-chan ProducerResult {
+	return ap.results
+}
+
+// ProduceAsync sends a message to the Kafka cluster without waiting for the delivery, callback is called with the delivery result
+// from the dispatching goroutine, it can be nil. it blocks only when the input channel of the producer is full.
+func (ap *asyncProducer) ProduceAsync(ctx context.Context, pm ProducerMessage, callback func(ProducerResult)) error {
+	ap.mu.RLock()
+	defer ap.mu.RUnlock()
+	if ap.closed {
+		return ErrProducerClosed
+	}
+
+	_, span := ap.tracer.startProduce(ctx, &pm)
+	sPm := toSaramaProducerMessage(pm)
+	sPm.Metadata = messageMetadata{partition: pm.Partition, delivery: &asyncDelivery{message: pm, callback: callback, span: span}}
+
+	ap.inflight.add()
+	select {
+	case <-ctx.Done():
+		ap.inflight.done()
+		endSpan(span, ctx.Err())
+		return ctx.Err()
+	case ap.Producer.Input() <- sPm:
+		return nil
+	}
+}
+
+// Flush waits until every message that is produced is delivered or failed, it returns error when context is done first.
+func (ap *asyncProducer) Flush(ctx context.Context) error {
+	return ap.inflight.wait(ctx)
+}
+
+// Close stops accepting messages, waits for the outstanding deliveries then closes the producer,
+// delivery results of messages that are not delivered before context is done are still dispatched as failed.
+func (ap *asyncProducer) Close(ctx context.Context) error {
+	ap.mu.Lock()
+	if ap.closed {
+		ap.mu.Unlock()
+		return ErrProducerClosed
+	}
+	ap.closed = true
+	ap.mu.Unlock()
+
+	err := ap.Flush(ctx)
+	ap.Producer.AsyncClose()
+	select {
+	case <-ap.dispatched:
+	case <-ctx.Done():
+		err = errors.Join(err, fmt.Errorf("delivery results are not dispatched: %w", ctx.Err()))
+	}
+	return err
+}
+
+// startDispatch dispatches delivery results of the sarama producer until both successes and errors channels are closed.
+func (ap *asyncProducer) startDispatch() {
+	defer close(ap.dispatched)
+	if ap.results != nil {
+		defer close(ap.results)
+	}
+
+	successes, errs := ap.Producer.Successes(), ap.Producer.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			ap.dispatch(msg, nil)
+		case perr, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			ap.logger.Error("unable to produce message",
+				"topic", perr.Msg.Topic,
+				"error", perr.Err,
+			)
+			ap.dispatch(perr.Msg, perr.Err)
+		}
+	}
+}
+
+// dispatch passes the delivery result of the message to its callback and the results channel.
+func (ap *asyncProducer) dispatch(msg *sarama.ProducerMessage, err error) {
+	md, ok := msg.Metadata.(messageMetadata)
+	if !ok || md.delivery == nil {
+		return
+	}
+	delivery := md.delivery
+	defer ap.inflight.done()
+
+	result := ProducerResult{
+		Message:   delivery.message,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Err:       err,
+	}
+	if delivery.span != nil {
+		delivery.span.SetAttributes(attributeMessagingPartition.Int(int(msg.Partition)), attributeMessagingOffset.Int64(msg.Offset))
+		endSpan(delivery.span, err)
+	}
+	if delivery.callback != nil {
+		delivery.callback(result)
+	}
+	if ap.results != nil {
+		ap.results <- result
+	}
+}
+
+// inflightCounter counts the messages that are waiting for the delivery result.
+type inflightCounter struct {
+	mu sync.Mutex
+	n  int
+	// idle is closed when the counter reaches 0
+	idle chan struct{}
+}
+
+// add increments the counter.
+func (ic *inflightCounter) add() {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	if ic.n == 0 {
+		ic.idle = make(chan struct{})
+	}
+	ic.n++
+}
+
+// done decrements the counter.
+func (ic *inflightCounter) done() {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	ic.n--
+	if ic.n == 0 {
+		close(ic.idle)
+	}
+}
+
+// wait blocks until the counter reaches 0 or context is done.
+func (ic *inflightCounter) wait(ctx context.Context) error {
+	ic.mu.Lock()
+	if ic.n == 0 {
+		ic.mu.Unlock()
+		return nil
+	}
+	idle := ic.idle
+	ic.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
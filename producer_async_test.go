@@ -0,0 +1,67 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/mrbryside/tessara/logger"
+)
+
+func TestAsyncProducerDeliversResultsToCallbackAndChannel(t *testing.T) {
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+	mp := mocks.NewAsyncProducer(t, cfg)
+	mp.ExpectInputAndSucceed()
+	mp.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+	ap := newAsyncProducer(mp, logger.Default(), newMessageTracer(noop.NewTracerProvider(), ""), 2)
+
+	var mu sync.Mutex
+	var callbackResults []ProducerResult
+	callback := func(r ProducerResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		callbackResults = append(callbackResults, r)
+	}
+	ctx := context.Background()
+	assert.NoError(t, ap.ProduceAsync(ctx, ProducerMessage{Topic: "orders", Key: "1"}, callback))
+	assert.NoError(t, ap.ProduceAsync(ctx, ProducerMessage{Topic: "orders", Key: "2"}, callback))
+
+	assert.NoError(t, ap.Flush(ctx))
+	mu.Lock()
+	assert.Len(t, callbackResults, 2)
+	mu.Unlock()
+
+	// successes and errors are dispatched from different channels so results are not ordered
+	results := map[string]ProducerResult{}
+	for range 2 {
+		r := <-ap.Results()
+		results[r.Message.Key] = r
+	}
+	assert.NoError(t, results["1"].Err)
+	assert.True(t, errors.Is(results["2"].Err, sarama.ErrNotLeaderForPartition))
+
+	assert.NoError(t, ap.Close(ctx))
+	_, ok := <-ap.Results()
+	assert.False(t, ok)
+	assert.ErrorIs(t, ap.ProduceAsync(ctx, ProducerMessage{Topic: "orders"}, nil), ErrProducerClosed)
+}
+
+func TestAsyncProducerFlushReturnsWhenContextDone(t *testing.T) {
+	var ic inflightCounter
+	ic.add()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, ic.wait(ctx), context.DeadlineExceeded)
+
+	ic.done()
+	assert.NoError(t, ic.wait(context.Background()))
+}
@@ -1,7 +1,12 @@
 package tessara
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
 	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/mrbryside/tessara/logger"
 )
@@ -9,35 +14,104 @@ import (
 // syncProducer represents a synchronous producer.
 type syncProducer struct {
 	Producer sarama.SyncProducer
+	logger   logger.Logger
+	tracer   messageTracer
 }
 
-// NewSyncProducer creates a new synchronous producer instance.
-func NewSyncProducer(config producerConfig) syncProducer {
+// NewSyncProducer creates a new synchronous producer instance, it returns error if the config is invalid or brokers are unreachable.
+func NewSyncProducer(config producerConfig) (*syncProducer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	producer, err := sarama.NewSyncProducer(config.brokers, config.ToSaramaConfig().Config())
 	if err != nil {
-		logger.Panic().Err(err).Msg("unable to create sync producer instance")
+		return nil, fmt.Errorf("unable to create sync producer instance: %w", err)
 	}
-	return syncProducer{
+	return &syncProducer{
 		Producer: producer,
-	}
+		logger:   config.logger,
+		tracer:   newMessageTracer(config.tracerProvider, ""),
+	}, nil
 }
 
 // Produce sends a message to the Kafka cluster synchronously.
 func (sp syncProducer) Produce(pm ProducerMessage) (partition int32, offset int64, err error) {
-	var headers []sarama.RecordHeader
-	for _, header := range pm.Headers {
-		headers = append(headers, sarama.RecordHeader{
-			Key:   []byte(header.Key),
-			Value: []byte(header.Value),
-		})
+	return sp.ProduceContext(context.Background(), pm)
+}
+
+// ProduceContext sends a message to the Kafka cluster synchronously, the trace context of ctx is injected into the headers of the message.
+func (sp syncProducer) ProduceContext(ctx context.Context, pm ProducerMessage) (partition int32, offset int64, err error) {
+	if sp.tracer.tracer != nil {
+		var span trace.Span
+		_, span = sp.tracer.startProduce(ctx, &pm)
+		defer func() {
+			span.SetAttributes(attributeMessagingPartition.Int(int(partition)), attributeMessagingOffset.Int64(offset))
+			endSpan(span, err)
+		}()
 	}
-	sPm := sarama.ProducerMessage{
-		Topic:   pm.Topic,
-		Value:   sarama.StringEncoder(pm.Value),
-		Key:     sarama.StringEncoder(pm.Key),
-		Headers: headers,
+
+	partition, offset, err = sp.Producer.SendMessage(toSaramaProducerMessage(pm))
+	if err != nil {
+		sp.logger.Error("unable to produce message",
+			"topic", pm.Topic,
+			"error", err,
+		)
 	}
+	return partition, offset, err
+}
 
-	return sp.Producer.SendMessage(&sPm)
+// ProduceBatch sends the messages to the Kafka cluster synchronously in one call, result of every message is returned in the order of the messages,
+// error is returned when any message is failed, it joins the errors of the failed messages.
+func (sp syncProducer) ProduceBatch(pms []ProducerMessage) ([]ProducerResult, error) {
+	return sp.ProduceBatchContext(context.Background(), pms)
+}
+
+// ProduceBatchContext sends the messages to the Kafka cluster synchronously in one call, the trace context of ctx is injected into the headers of every message.
+func (sp syncProducer) ProduceBatchContext(ctx context.Context, pms []ProducerMessage) ([]ProducerResult, error) {
+	sent := make([]ProducerMessage, len(pms))
+	sPms := make([]*sarama.ProducerMessage, len(pms))
+	spans := make([]trace.Span, len(pms))
+	for i, pm := range pms {
+		if sp.tracer.tracer != nil {
+			_, spans[i] = sp.tracer.startProduce(ctx, &pm)
+		}
+		sent[i] = pm
+		sPms[i] = toSaramaProducerMessage(pm)
+	}
 
+	// failed messages are reported by sarama with the pointer of the message that is sent
+	failed := make(map[*sarama.ProducerMessage]error)
+	sendErr := sp.Producer.SendMessages(sPms)
+	var perrs sarama.ProducerErrors
+	if errors.As(sendErr, &perrs) {
+		for _, perr := range perrs {
+			failed[perr.Msg] = perr.Err
+		}
+	}
+
+	results := make([]ProducerResult, len(pms))
+	var errs []error
+	for i, sPm := range sPms {
+		err, ok := failed[sPm]
+		if !ok && sendErr != nil && len(perrs) == 0 {
+			// error is not reported per message, every message is considered failed
+			err = sendErr
+		}
+		results[i] = ProducerResult{Message: sent[i], Partition: sPm.Partition, Offset: sPm.Offset, Err: err}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to produce message %d to topic %s: %w", i, pms[i].Topic, err))
+		}
+		if spans[i] != nil {
+			spans[i].SetAttributes(attributeMessagingPartition.Int(int(sPm.Partition)), attributeMessagingOffset.Int64(sPm.Offset))
+			endSpan(spans[i], err)
+		}
+	}
+	if len(errs) > 0 {
+		sp.logger.Error("unable to produce batch",
+			"size", len(pms),
+			"failed", len(errs),
+			"error", sendErr,
+		)
+	}
+	return results, errors.Join(errs...)
 }
@@ -0,0 +1,73 @@
+package tessara
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mrbryside/tessara/logger"
+)
+
+// partialFailSyncProducer fails the messages of the given keys the same way as sarama reports per message errors
+type partialFailSyncProducer struct {
+	sarama.SyncProducer
+	failKeys map[string]error
+}
+
+func (p partialFailSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var perrs sarama.ProducerErrors
+	for i, msg := range msgs {
+		key, _ := msg.Key.Encode()
+		if err, ok := p.failKeys[string(key)]; ok {
+			perrs = append(perrs, &sarama.ProducerError{Msg: msg, Err: err})
+			continue
+		}
+		msg.Partition, msg.Offset = 0, int64(i)
+	}
+	if len(perrs) > 0 {
+		return perrs
+	}
+	return nil
+}
+
+func TestProduceBatchReturnsResultOfEveryMessage(t *testing.T) {
+	mp := mocks.NewSyncProducer(t, nil)
+	mp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		key, _ := msg.Key.Encode()
+		assert.Equal(t, "order-1", string(key))
+		assert.Equal(t, []sarama.RecordHeader{{Key: []byte("tenant-id"), Value: []byte("tenant-a")}}, msg.Headers)
+		return nil
+	})
+	mp.ExpectSendMessageAndSucceed()
+	sp := syncProducer{Producer: mp, logger: logger.Default()}
+
+	results, err := sp.ProduceBatch([]ProducerMessage{
+		{Topic: "orders", Key: "order-1", Headers: Headers{{Key: "tenant-id", Value: []byte("tenant-a")}}},
+		{Topic: "orders", Key: "order-2"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, int64(1), results[0].Offset)
+	assert.Equal(t, int64(2), results[1].Offset)
+}
+
+func TestProduceBatchReportsFailedMessages(t *testing.T) {
+	sp := syncProducer{
+		Producer: partialFailSyncProducer{failKeys: map[string]error{"order-2": sarama.ErrMessageSizeTooLarge}},
+		logger:   logger.Default(),
+	}
+
+	results, err := sp.ProduceBatch([]ProducerMessage{
+		{Topic: "orders", Key: "order-1"},
+		{Topic: "orders", Key: "order-2"},
+		{Topic: "orders", Key: "order-3"},
+	})
+	assert.True(t, errors.Is(err, sarama.ErrMessageSizeTooLarge))
+	assert.NoError(t, results[0].Err)
+	assert.True(t, errors.Is(results[1].Err, sarama.ErrMessageSizeTooLarge))
+	assert.NoError(t, results[2].Err)
+	assert.Equal(t, int64(2), results[2].Offset)
+}
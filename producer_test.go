@@ -0,0 +1,42 @@
+package tessara
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeadersLookup(t *testing.T) {
+	hs := Headers{
+		{Key: "tenant-id", Value: []byte("tenant-a")},
+		{Key: "correlation-id", Value: []byte("correlation-1")},
+		{Key: "tenant-id", Value: []byte("tenant-b")},
+	}
+
+	value, ok := hs.Get("tenant-id")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, value, []byte("tenant-a"))
+	assert.Equal(t, hs.Values("tenant-id"), [][]byte{[]byte("tenant-a"), []byte("tenant-b")})
+	assert.Equal(t, hs.Has("correlation-id"), true)
+
+	_, ok = hs.Get("schema-version")
+	assert.Equal(t, ok, false)
+	assert.Equal(t, hs.Has("schema-version"), false)
+}
+
+func TestHeadersProduceConsumeRoundTrip(t *testing.T) {
+	hs := Headers{
+		{Key: "tenant-id", Value: []byte("tenant-a")},
+		{Key: "schema-version", Value: []byte("2")},
+	}
+
+	// simulate the record headers that consumer receives from the produced record headers
+	var consumed []*sarama.RecordHeader
+	for _, rh := range toSaramaHeaders(hs) {
+		consumed = append(consumed, &rh)
+	}
+	pm := toPerformMessage(&sarama.ConsumerMessage{Headers: consumed})
+
+	assert.Equal(t, pm.Headers, hs)
+}
@@ -0,0 +1,129 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/IBM/sarama"
+)
+
+var (
+	// ErrProducerFenced is the kind of the transaction error when another producer with the same transactional id has started,
+	// the producer can not be used anymore and has to be closed.
+	ErrProducerFenced = errors.New("producer is fenced")
+	// ErrTransactionAbortable is the kind of the transaction error when the transaction has failed and must be aborted by AbortTxn,
+	// a new transaction can be started after the abort.
+	ErrTransactionAbortable = errors.New("transaction must be aborted")
+	// ErrTransactionFatal is the kind of the transaction error when the producer is in an unrecoverable state and has to be closed.
+	ErrTransactionFatal = errors.New("transaction is in fatal state")
+)
+
+// TransactionError is returned by the transactional producer when a transaction operation is failed,
+// errors.Is matches both the kind and the cause of the error.
+type TransactionError struct {
+	// Op is the operation that is failed, it's one of begin, produce, add_offsets, commit and abort
+	Op string
+	// Kind is one of ErrProducerFenced, ErrTransactionAbortable and ErrTransactionFatal, it's nil when the error is not classified
+	Kind error
+	Err  error
+}
+
+// Error returns the error message.
+func (e *TransactionError) Error() string {
+	if e.Kind == nil {
+		return fmt.Sprintf("transaction %s failed: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("transaction %s failed: %v: %v", e.Op, e.Kind, e.Err)
+}
+
+// Unwrap returns the kind and the cause of the error.
+func (e *TransactionError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// transactionalProducer represents a producer that writes messages to several topics atomically.
+type transactionalProducer struct {
+	producer syncProducer
+}
+
+// NewTransactionalProducer creates a new transactional producer instance, transactional id has to be set by WithTransactionalID.
+func NewTransactionalProducer(config producerConfig) (*transactionalProducer, error) {
+	if !config.isTransactional() {
+		return nil, errors.New("transactional id must be set for transactional producer")
+	}
+	producer, err := NewSyncProducer(config)
+	if err != nil {
+		return nil, err
+	}
+	return &transactionalProducer{producer: *producer}, nil
+}
+
+// BeginTxn starts a new transaction.
+func (tp *transactionalProducer) BeginTxn() error {
+	return tp.transactionError("begin", tp.producer.Producer.BeginTxn())
+}
+
+// Produce sends a message within the transaction, message is only visible to read_committed consumers once the transaction is committed.
+func (tp *transactionalProducer) Produce(pm ProducerMessage) (partition int32, offset int64, err error) {
+	return tp.ProduceContext(context.Background(), pm)
+}
+
+// ProduceContext sends a message within the transaction, the trace context of ctx is injected into the headers of the message.
+func (tp *transactionalProducer) ProduceContext(ctx context.Context, pm ProducerMessage) (partition int32, offset int64, err error) {
+	partition, offset, err = tp.producer.ProduceContext(ctx, pm)
+	return partition, offset, tp.transactionError("produce", err)
+}
+
+// AddOffsetToTxn adds the offset of the consumer group to the transaction, offset is committed only if the transaction is committed,
+// offset is the offset of the next message to consume.
+func (tp *transactionalProducer) AddOffsetToTxn(topic string, partition int32, offset int64, groupID string) error {
+	offsets := map[string][]*sarama.PartitionOffsetMetadata{
+		topic: {{Partition: partition, Offset: offset}},
+	}
+	return tp.transactionError("add_offsets", tp.producer.Producer.AddOffsetsToTxn(offsets, groupID))
+}
+
+// CommitTxn commits the transaction, transaction has to be aborted when error of ErrTransactionAbortable is returned.
+func (tp *transactionalProducer) CommitTxn() error {
+	return tp.transactionError("commit", tp.producer.Producer.CommitTxn())
+}
+
+// AbortTxn aborts the transaction, messages produced within the transaction are skipped by read_committed consumers.
+func (tp *transactionalProducer) AbortTxn() error {
+	return tp.transactionError("abort", tp.producer.Producer.AbortTxn())
+}
+
+// Close closes the producer, transaction that is not committed is aborted by the broker once it's timed out.
+func (tp *transactionalProducer) Close() error {
+	return tp.producer.Producer.Close()
+}
+
+// isAbortable returns true if the producer has a transaction that is started or failed, it has to be aborted before the next one.
+func (tp *transactionalProducer) isAbortable() bool {
+	return tp.producer.Producer.TxnStatus()&(sarama.ProducerTxnFlagInTransaction|sarama.ProducerTxnFlagAbortableError) != 0
+}
+
+// transactionError classifies the error of the transaction operation by the error and the transaction status of the producer.
+func (tp *transactionalProducer) transactionError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TransactionError{Op: op, Kind: transactionErrorKind(err, tp.producer.Producer.TxnStatus()), Err: err}
+}
+
+// transactionErrorKind returns the kind of the transaction error.
+func transactionErrorKind(err error, status sarama.ProducerTxnStatusFlag) error {
+	switch {
+	case errors.Is(err, sarama.ErrProducerFenced), errors.Is(err, sarama.ErrInvalidProducerEpoch):
+		return ErrProducerFenced
+	case status&sarama.ProducerTxnFlagFatalError != 0:
+		return ErrTransactionFatal
+	case status&sarama.ProducerTxnFlagAbortableError != 0:
+		return ErrTransactionAbortable
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package tessara
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mrbryside/tessara/logger"
+)
+
+// failingTxnSyncProducer fails the commit with the given error and transaction status
+type failingTxnSyncProducer struct {
+	*mocks.SyncProducer
+	commitErr error
+	status    sarama.ProducerTxnStatusFlag
+}
+
+func (p failingTxnSyncProducer) CommitTxn() error {
+	return p.commitErr
+}
+
+func (p failingTxnSyncProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	return p.status
+}
+
+func TestTransactionalProducerCommitsProducedMessages(t *testing.T) {
+	mp := mocks.NewSyncProducer(t, nil)
+	mp.ExpectSendMessageAndSucceed()
+	tp := transactionalProducer{producer: syncProducer{Producer: mp, logger: logger.Default()}}
+
+	assert.NoError(t, tp.BeginTxn())
+	assert.Equal(t, sarama.ProducerTxnFlagInTransaction, mp.TxnStatus())
+	_, _, err := tp.Produce(ProducerMessage{Topic: "orders", Key: "order-1"})
+	assert.NoError(t, err)
+	assert.NoError(t, tp.CommitTxn())
+	assert.Equal(t, sarama.ProducerTxnFlagReady, mp.TxnStatus())
+}
+
+func TestTransactionalProducerClassifiesErrors(t *testing.T) {
+	fenced := transactionalProducer{producer: syncProducer{
+		Producer: failingTxnSyncProducer{SyncProducer: mocks.NewSyncProducer(t, nil), commitErr: sarama.ErrProducerFenced, status: sarama.ProducerTxnFlagFatalError},
+		logger:   logger.Default(),
+	}}
+	err := fenced.CommitTxn()
+	var txnErr *TransactionError
+	assert.True(t, errors.As(err, &txnErr))
+	assert.Equal(t, "commit", txnErr.Op)
+	assert.ErrorIs(t, err, ErrProducerFenced)
+	assert.ErrorIs(t, err, sarama.ErrProducerFenced)
+
+	abortable := transactionalProducer{producer: syncProducer{
+		Producer: failingTxnSyncProducer{SyncProducer: mocks.NewSyncProducer(t, nil), commitErr: sarama.ErrOutOfOrderSequenceNumber, status: sarama.ProducerTxnFlagInError | sarama.ProducerTxnFlagAbortableError},
+		logger:   logger.Default(),
+	}}
+	assert.ErrorIs(t, abortable.CommitTxn(), ErrTransactionAbortable)
+}
+
+func TestTransactionalIDTurnsOnIdempotence(t *testing.T) {
+	pc := NewProducerConfig([]string{"localhost:9092"}).WithTransactionalID("orders-writer")
+	assert.NoError(t, pc.Validate())
+
+	cfg := pc.ToSaramaConfig().Config()
+	assert.Equal(t, "orders-writer", cfg.Producer.Transaction.ID)
+	assert.True(t, cfg.Producer.Idempotent)
+	assert.Equal(t, 1, cfg.Net.MaxOpenRequests)
+	assert.NoError(t, cfg.Validate())
+
+	assert.Error(t, NewProducerConfig([]string{"localhost:9092"}).WithTransactionalID("").Validate())
+}
@@ -0,0 +1,67 @@
+package tessara
+
+import (
+	"context"
+	"fmt"
+)
+
+// TypedProducerMessage represents a message of type T to be encoded by the codec of the typed producer.
+type TypedProducerMessage[T any] struct {
+	Topic     string
+	Partition *int32 // explicit partition of the message, partitioner is used when it's nil
+	Key       string
+	Headers   Headers
+	Value     T
+
+	MetricLabelKeyType string
+}
+
+// typedProducer represents a synchronous producer that encodes values with the codec.
+type typedProducer[T any] struct {
+	producer *syncProducer
+	codec    Codec[T]
+}
+
+// NewTypedProducer creates a new typed producer instance, it returns error if the config is invalid or brokers are unreachable.
+func NewTypedProducer[T any](config producerConfig, codec Codec[T]) (*typedProducer[T], error) {
+	producer, err := NewSyncProducer(config)
+	if err != nil {
+		return nil, err
+	}
+	return &typedProducer[T]{producer: producer, codec: codec}, nil
+}
+
+// Produce encodes the value then sends the message to the Kafka cluster.
+func (tp *typedProducer[T]) Produce(pm TypedProducerMessage[T]) (partition int32, offset int64, err error) {
+	return tp.ProduceContext(context.Background(), pm)
+}
+
+// ProduceContext encodes the value then sends the message to the Kafka cluster, the trace context of ctx is injected into the headers.
+func (tp *typedProducer[T]) ProduceContext(ctx context.Context, pm TypedProducerMessage[T]) (partition int32, offset int64, err error) {
+	msg, err := tp.encode(ctx, pm)
+	if err != nil {
+		return -1, -1, err
+	}
+	return tp.producer.ProduceContext(ctx, msg)
+}
+
+// Close closes the producer.
+func (tp *typedProducer[T]) Close() error {
+	return tp.producer.Producer.Close()
+}
+
+// encode converts the typed message to the producer message by encoding its value.
+func (tp *typedProducer[T]) encode(ctx context.Context, pm TypedProducerMessage[T]) (ProducerMessage, error) {
+	value, err := encodeContext(ctx, tp.codec, pm.Value)
+	if err != nil {
+		return ProducerMessage{}, fmt.Errorf("%w: %w", ErrEncode, err)
+	}
+	return ProducerMessage{
+		Topic:              pm.Topic,
+		Partition:          pm.Partition,
+		Key:                pm.Key,
+		Headers:            pm.Headers,
+		Value:              value,
+		MetricLabelKeyType: pm.MetricLabelKeyType,
+	}, nil
+}
@@ -0,0 +1,184 @@
+package tessara
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+// RetryStrategy represents the strategy that computes the interval between retries.
+type RetryStrategy string
+
+const (
+	// RetryStrategyExponential multiplies the interval by the multiplier on every retry.
+	RetryStrategyExponential RetryStrategy = "exponential"
+	// RetryStrategyConstant waits the same interval on every retry.
+	RetryStrategyConstant RetryStrategy = "constant"
+	// RetryStrategyLinear adds the increment to the interval on every retry.
+	RetryStrategyLinear RetryStrategy = "linear"
+	// RetryStrategyDecorrelatedJitter picks a random interval between the initial interval and 3 times of the previous interval.
+	RetryStrategyDecorrelatedJitter RetryStrategy = "decorrelated_jitter"
+)
+
+// RetryPolicy represents the retry configuration of the message handler.
+type RetryPolicy struct {
+	strategy            RetryStrategy
+	maxRetries          int
+	initialInterval     time.Duration
+	maxInterval         time.Duration
+	multiplier          float64
+	increment           time.Duration
+	randomizationFactor float64
+	maxElapsedTime      time.Duration
+}
+
+// NewExponentialRetryPolicy creates a retry policy that multiplies the interval by the multiplier on every retry,
+// max interval is 60 seconds, randomization factor is 0.5 and max elapsed time is 15 minutes by default.
+func NewExponentialRetryPolicy(maxRetries int, initialInterval time.Duration, multiplier float64) RetryPolicy {
+	rp := newRetryPolicy(RetryStrategyExponential, maxRetries, initialInterval)
+	rp.multiplier = multiplier
+	rp.randomizationFactor = backoff.DefaultRandomizationFactor
+	rp.maxElapsedTime = backoff.DefaultMaxElapsedTime
+	return rp
+}
+
+// NewConstantRetryPolicy creates a retry policy that waits the same interval on every retry.
+func NewConstantRetryPolicy(maxRetries int, interval time.Duration) RetryPolicy {
+	return newRetryPolicy(RetryStrategyConstant, maxRetries, interval)
+}
+
+// NewLinearRetryPolicy creates a retry policy that adds the increment to the interval on every retry.
+func NewLinearRetryPolicy(maxRetries int, initialInterval time.Duration, increment time.Duration) RetryPolicy {
+	rp := newRetryPolicy(RetryStrategyLinear, maxRetries, initialInterval)
+	rp.increment = increment
+	return rp
+}
+
+// NewDecorrelatedJitterRetryPolicy creates a retry policy that picks a random interval between the base interval and 3 times of the previous interval,
+// interval is capped by max interval.
+func NewDecorrelatedJitterRetryPolicy(maxRetries int, baseInterval time.Duration, maxInterval time.Duration) RetryPolicy {
+	rp := newRetryPolicy(RetryStrategyDecorrelatedJitter, maxRetries, baseInterval)
+	return rp.WithMaxInterval(maxInterval)
+}
+
+// newRetryPolicy creates a retry policy with the common defaults.
+func newRetryPolicy(strategy RetryStrategy, maxRetries int, initialInterval time.Duration) RetryPolicy {
+	return RetryPolicy{
+		strategy:        strategy,
+		maxRetries:      maxRetries,
+		initialInterval: initialInterval,
+		maxInterval:     backoff.DefaultMaxInterval,
+	}
+}
+
+// WithMaxInterval sets the cap of the interval between retries. (default: 60 seconds)
+func (rp RetryPolicy) WithMaxInterval(maxInterval time.Duration) RetryPolicy {
+	rp.maxInterval = maxInterval
+	return rp
+}
+
+// WithRandomizationFactor sets the randomization factor, interval is randomized between interval * (1 - factor) and interval * (1 + factor),
+// it's not applied to decorrelated jitter strategy. (default: 0.5 for exponential, 0 for others)
+func (rp RetryPolicy) WithRandomizationFactor(randomizationFactor float64) RetryPolicy {
+	rp.randomizationFactor = randomizationFactor
+	return rp
+}
+
+// WithMaxElapsedTime sets the max time since the first attempt that retry is allowed, 0 means no limit. (default: 15 minutes for exponential, 0 for others)
+func (rp RetryPolicy) WithMaxElapsedTime(maxElapsedTime time.Duration) RetryPolicy {
+	rp.maxElapsedTime = maxElapsedTime
+	return rp
+}
+
+// Validate returns every problem of the retry policy joined into one error, it returns nil if the retry policy is valid.
+func (rp RetryPolicy) Validate() error {
+	var errs []error
+	if rp.maxRetries < 0 {
+		errs = append(errs, errors.New("max retry must be greater than or equal to 0"))
+	}
+	if rp.initialInterval <= 0 {
+		errs = append(errs, errors.New("retry interval must be greater than 0"))
+	}
+	if rp.maxInterval <= 0 {
+		errs = append(errs, errors.New("retry max interval must be greater than 0"))
+	}
+	if rp.strategy == RetryStrategyExponential && rp.multiplier <= 0 {
+		errs = append(errs, errors.New("retry multiplier must be greater than 0"))
+	}
+	if rp.strategy == RetryStrategyLinear && rp.increment < 0 {
+		errs = append(errs, errors.New("retry increment must be greater than or equal to 0"))
+	}
+	if rp.randomizationFactor < 0 || rp.randomizationFactor > 1 {
+		errs = append(errs, errors.New("retry randomization factor must be between 0 and 1"))
+	}
+	if rp.maxElapsedTime < 0 {
+		errs = append(errs, errors.New("retry max elapsed time must be greater than or equal to 0"))
+	}
+	return errors.Join(errs...)
+}
+
+// MaxRetries returns the max number of retries.
+func (rp RetryPolicy) MaxRetries() int {
+	return rp.maxRetries
+}
+
+// newBackOff creates the backoff of a message, backoff returns backoff.Stop once max retries or max elapsed time is reached.
+func (rp RetryPolicy) newBackOff() backoff.BackOff {
+	b := &retryPolicyBackOff{policy: rp}
+	b.Reset()
+	return b
+}
+
+// retryPolicyBackOff implements backoff.BackOff for the retry policy.
+type retryPolicyBackOff struct {
+	policy       RetryPolicy
+	retries      int
+	prevInterval time.Duration
+	startTime    time.Time
+}
+
+// Reset resets the backoff to the initial state.
+func (b *retryPolicyBackOff) Reset() {
+	b.retries = 0
+	b.prevInterval = 0
+	b.startTime = time.Now()
+}
+
+// NextBackOff returns the interval before the next retry or backoff.Stop when retry is not allowed anymore.
+func (b *retryPolicyBackOff) NextBackOff() time.Duration {
+	rp := b.policy
+	if b.retries >= rp.maxRetries {
+		return backoff.Stop
+	}
+	if rp.maxElapsedTime > 0 && time.Since(b.startTime) > rp.maxElapsedTime {
+		return backoff.Stop
+	}
+
+	var interval time.Duration
+	switch rp.strategy {
+	case RetryStrategyConstant:
+		interval = rp.initialInterval
+	case RetryStrategyLinear:
+		interval = rp.initialInterval + time.Duration(b.retries)*rp.increment
+	case RetryStrategyDecorrelatedJitter:
+		upper := max(b.prevInterval*3, rp.initialInterval)
+		interval = rp.initialInterval + time.Duration(rand.Int63n(int64(upper-rp.initialInterval)+1))
+	default:
+		interval = rp.initialInterval
+		if b.prevInterval > 0 {
+			interval = time.Duration(float64(b.prevInterval) * rp.multiplier)
+		}
+	}
+	interval = min(interval, rp.maxInterval)
+	b.prevInterval = interval
+	b.retries++
+
+	if rp.strategy != RetryStrategyDecorrelatedJitter && rp.randomizationFactor > 0 {
+		delta := rp.randomizationFactor * float64(interval)
+		minInterval := float64(interval) - delta
+		interval = time.Duration(minInterval + rand.Float64()*(2*delta+1))
+	}
+	return interval
+}
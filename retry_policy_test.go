@@ -0,0 +1,70 @@
+package tessara
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/stretchr/testify/assert"
+)
+
+func nextBackOffs(b backoff.BackOff, n int) []time.Duration {
+	var intervals []time.Duration
+	for range n {
+		intervals = append(intervals, b.NextBackOff())
+	}
+	return intervals
+}
+
+func TestConstantRetryPolicy(t *testing.T) {
+	b := NewConstantRetryPolicy(3, 100*time.Millisecond).newBackOff()
+
+	assert.Equal(t, nextBackOffs(b, 4), []time.Duration{100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond, backoff.Stop})
+}
+
+func TestLinearRetryPolicyIsCappedByMaxInterval(t *testing.T) {
+	b := NewLinearRetryPolicy(4, 100*time.Millisecond, 100*time.Millisecond).
+		WithMaxInterval(250 * time.Millisecond).
+		newBackOff()
+
+	assert.Equal(t, nextBackOffs(b, 5), []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 250 * time.Millisecond, 250 * time.Millisecond, backoff.Stop})
+}
+
+func TestExponentialRetryPolicyWithoutRandomization(t *testing.T) {
+	b := NewExponentialRetryPolicy(3, 100*time.Millisecond, 2).
+		WithRandomizationFactor(0).
+		newBackOff()
+
+	assert.Equal(t, nextBackOffs(b, 4), []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, backoff.Stop})
+}
+
+func TestDecorrelatedJitterRetryPolicyStaysInBounds(t *testing.T) {
+	b := NewDecorrelatedJitterRetryPolicy(100, 10*time.Millisecond, 200*time.Millisecond).newBackOff()
+
+	for _, interval := range nextBackOffs(b, 100) {
+		assert.GreaterOrEqual(t, interval, 10*time.Millisecond)
+		assert.LessOrEqual(t, interval, 200*time.Millisecond)
+	}
+	assert.Equal(t, b.NextBackOff(), backoff.Stop)
+}
+
+func TestRetryPolicyStopsAfterMaxElapsedTime(t *testing.T) {
+	b := NewConstantRetryPolicy(10, time.Millisecond).
+		WithMaxElapsedTime(10 * time.Millisecond).
+		newBackOff()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, b.NextBackOff(), backoff.Stop)
+}
+
+func TestTopicRetryPolicyOverridesConsumerRetryPolicy(t *testing.T) {
+	cfg := NewConsumerConfig([]string{"fake broker"}, "orders", "fake-group").
+		WithRetryPolicy(NewConstantRetryPolicy(2, time.Second))
+	c := NewConsumer(cfg, messageBenchMarkHandler{}).
+		WithTopic(NewTopicConfig("payments").WithRetryPolicy(NewConstantRetryPolicy(5, time.Second)), messageBenchMarkHandler{})
+
+	orders, _ := c.consumerGroupHandler.topicHandler("orders")
+	payments, _ := c.consumerGroupHandler.topicHandler("payments")
+	assert.Equal(t, orders.topicConfig.retryPolicy.MaxRetries(), 2)
+	assert.Equal(t, payments.topicConfig.retryPolicy.MaxRetries(), 5)
+}
@@ -0,0 +1,130 @@
+package tessara
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// headers included in the record that is published to the retry topic
+const (
+	HeaderRetryNotBefore       = "tessara-retry-not-before"
+	HeaderRetryAttempt         = "tessara-retry-attempt"
+	HeaderRetrySourceTopic     = "tessara-retry-source-topic"
+	HeaderRetrySourcePartition = "tessara-retry-source-partition"
+	HeaderRetrySourceOffset    = "tessara-retry-source-offset"
+	HeaderRetryError           = "tessara-retry-error"
+)
+
+// retryHeaderPrefix is the prefix of every retry header
+const retryHeaderPrefix = "tessara-retry-"
+
+// retryTier represents the position of a topic in the retry topic chain
+type retryTier struct {
+	// next retry topic that failed messages are published to, it's empty for the last tier
+	nextTopic string
+	nextDelay time.Duration
+}
+
+// retryTopicName returns the retry topic name of the topic with the given delay e.g. orders.retry.5s
+func retryTopicName(topic string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", topic, formatRetryDelay(delay))
+}
+
+// formatRetryDelay formats the delay with the biggest unit that can represent it without fraction e.g. 1m instead of 1m0s
+func formatRetryDelay(delay time.Duration) string {
+	switch {
+	case delay%time.Hour == 0:
+		return fmt.Sprintf("%dh", delay/time.Hour)
+	case delay%time.Minute == 0:
+		return fmt.Sprintf("%dm", delay/time.Minute)
+	case delay%time.Second == 0:
+		return fmt.Sprintf("%ds", delay/time.Second)
+	default:
+		return fmt.Sprintf("%dms", delay/time.Millisecond)
+	}
+}
+
+// retryTopicPublisher publishes the failed messages to the retry topic with a not-before timestamp
+type retryTopicPublisher struct {
+	producer syncProducer
+	topic    string
+	delay    time.Duration
+}
+
+// newRetryTopicPublisher creates a new retry topic publisher instance
+func newRetryTopicPublisher(producer syncProducer, topic string, delay time.Duration) *retryTopicPublisher {
+	return &retryTopicPublisher{
+		producer: producer,
+		topic:    topic,
+		delay:    delay,
+	}
+}
+
+// Publish publishes the consumer message with its original key, value and headers to the retry topic,
+// source headers are kept from the first failure so the record can be traced back to the original topic
+func (p *retryTopicPublisher) Publish(ctx context.Context, cm *sarama.ConsumerMessage, err error) error {
+	consumedHeaders := fromSaramaHeaders(cm.Headers)
+	attempt := 0
+	if v, ok := consumedHeaders.Get(HeaderRetryAttempt); ok {
+		attempt, _ = strconv.Atoi(string(v))
+	}
+
+	var headers Headers
+	for _, h := range consumedHeaders {
+		if !strings.HasPrefix(h.Key, retryHeaderPrefix) {
+			headers = append(headers, h)
+		}
+	}
+	sourceTopic, sourcePartition, sourceOffset := []byte(cm.Topic), []byte(strconv.FormatInt(int64(cm.Partition), 10)), []byte(strconv.FormatInt(cm.Offset, 10))
+	if attempt > 0 {
+		sourceTopic, _ = consumedHeaders.Get(HeaderRetrySourceTopic)
+		sourcePartition, _ = consumedHeaders.Get(HeaderRetrySourcePartition)
+		sourceOffset, _ = consumedHeaders.Get(HeaderRetrySourceOffset)
+	}
+	headers = append(headers,
+		Header{Key: HeaderRetryNotBefore, Value: []byte(time.Now().Add(p.delay).UTC().Format(time.RFC3339Nano))},
+		Header{Key: HeaderRetryAttempt, Value: []byte(strconv.Itoa(attempt + 1))},
+		Header{Key: HeaderRetrySourceTopic, Value: sourceTopic},
+		Header{Key: HeaderRetrySourcePartition, Value: sourcePartition},
+		Header{Key: HeaderRetrySourceOffset, Value: sourceOffset},
+		Header{Key: HeaderRetryError, Value: []byte(err.Error())},
+	)
+
+	_, _, produceErr := p.producer.ProduceContext(ctx, ProducerMessage{
+		Topic:   p.topic,
+		Key:     string(cm.Key),
+		Headers: headers,
+		Value:   cm.Value,
+	})
+	return produceErr
+}
+
+// waitRetryDue blocks until the not-before timestamp of the message, it returns immediately if the message has no not-before header
+func waitRetryDue(ctx context.Context, cm *sarama.ConsumerMessage) error {
+	v, ok := fromSaramaHeaders(cm.Headers).Get(HeaderRetryNotBefore)
+	if !ok {
+		return nil
+	}
+	notBefore, err := time.Parse(time.RFC3339Nano, string(v))
+	if err != nil {
+		return nil
+	}
+	wait := time.Until(notBefore)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
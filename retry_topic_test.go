@@ -0,0 +1,94 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mrbryside/tessara/logger"
+)
+
+func TestRetryTopicName(t *testing.T) {
+	assert.Equal(t, retryTopicName("orders", 5*time.Second), "orders.retry.5s")
+	assert.Equal(t, retryTopicName("orders", time.Minute), "orders.retry.1m")
+	assert.Equal(t, retryTopicName("orders", 2*time.Hour), "orders.retry.2h")
+	assert.Equal(t, retryTopicName("orders", 1500*time.Millisecond), "orders.retry.1500ms")
+}
+
+func TestRetryTopicPublishKeepsSourceOfFirstFailure(t *testing.T) {
+	mp := mocks.NewSyncProducer(t, nil)
+	defer mp.Close()
+
+	var published []*sarama.ProducerMessage
+	checker := func(msg *sarama.ProducerMessage) error {
+		published = append(published, msg)
+		return nil
+	}
+	mp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checker)
+	mp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checker)
+
+	// first failure from source topic
+	err := newRetryTopicPublisher(syncProducer{Producer: mp, logger: logger.Default()}, "orders.retry.5s", 5*time.Second).Publish(context.Background(), &sarama.ConsumerMessage{
+		Topic:     "orders",
+		Partition: 1,
+		Offset:    10,
+		Key:       []byte("order-1"),
+		Value:     []byte("payload"),
+		Headers:   []*sarama.RecordHeader{{Key: []byte("tenant-id"), Value: []byte("tenant-a")}},
+	}, errors.New("first failure"))
+	assert.NoError(t, err)
+
+	// second failure from the first retry topic
+	var consumed []*sarama.RecordHeader
+	for _, h := range published[0].Headers {
+		consumed = append(consumed, &h)
+	}
+	err = newRetryTopicPublisher(syncProducer{Producer: mp, logger: logger.Default()}, "orders.retry.1m", time.Minute).Publish(context.Background(), &sarama.ConsumerMessage{
+		Topic:     "orders.retry.5s",
+		Partition: 0,
+		Offset:    3,
+		Key:       []byte("order-1"),
+		Value:     []byte("payload"),
+		Headers:   consumed,
+	}, errors.New("second failure"))
+	assert.NoError(t, err)
+
+	var produced []*sarama.RecordHeader
+	for _, h := range published[1].Headers {
+		produced = append(produced, &h)
+	}
+	headers := fromSaramaHeaders(produced)
+	assert.Equal(t, published[1].Topic, "orders.retry.1m")
+	assert.Equal(t, headers.Values(HeaderRetryAttempt), [][]byte{[]byte("2")})
+	assert.Equal(t, headers.Values(HeaderRetrySourceTopic), [][]byte{[]byte("orders")})
+	assert.Equal(t, headers.Values(HeaderRetrySourcePartition), [][]byte{[]byte("1")})
+	assert.Equal(t, headers.Values(HeaderRetrySourceOffset), [][]byte{[]byte("10")})
+	assert.Equal(t, headers.Values(HeaderRetryError), [][]byte{[]byte("second failure")})
+	assert.Equal(t, headers.Values("tenant-id"), [][]byte{[]byte("tenant-a")})
+
+	notBefore, _ := headers.Get(HeaderRetryNotBefore)
+	notBeforeTime, err := time.Parse(time.RFC3339Nano, string(notBefore))
+	assert.NoError(t, err)
+	assert.WithinDuration(t, notBeforeTime, time.Now().Add(time.Minute), time.Second)
+}
+
+func TestWaitRetryDue(t *testing.T) {
+	notBefore := time.Now().Add(200 * time.Millisecond).UTC().Format(time.RFC3339Nano)
+	cm := &sarama.ConsumerMessage{
+		Headers: []*sarama.RecordHeader{{Key: []byte(HeaderRetryNotBefore), Value: []byte(notBefore)}},
+	}
+
+	start := time.Now()
+	assert.NoError(t, waitRetryDue(context.Background(), cm))
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cm.Headers[0].Value = []byte(time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano))
+	assert.ErrorIs(t, waitRetryDue(ctx, cm), context.Canceled)
+}
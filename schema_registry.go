@@ -0,0 +1,188 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+)
+
+var (
+	// ErrSchemaNotFound is returned by the schema registry when the schema or the subject is not registered.
+	ErrSchemaNotFound = errors.New("schema not found")
+	// ErrIncompatibleSchema is returned when the schema is not compatible with the latest schema of the subject.
+	ErrIncompatibleSchema = errors.New("schema is incompatible")
+	// ErrSchemaRegistryUnavailable is returned when the schema registry is unreachable or responds with server error,
+	// typed consumer retries the message instead of treating it as a decode error.
+	ErrSchemaRegistryUnavailable = errors.New("schema registry is unavailable")
+)
+
+// SchemaType is the type of the schema, it's the schema type of the Confluent schema registry.
+type SchemaType string
+
+const (
+	SchemaTypeAvro     SchemaType = "AVRO"
+	SchemaTypeProtobuf SchemaType = "PROTOBUF"
+	SchemaTypeJSON     SchemaType = "JSON"
+)
+
+// Compatibility is the compatibility level that is checked when a new schema is registered to a subject.
+type Compatibility string
+
+const (
+	// CompatibilityNone accepts every schema of the same type
+	CompatibilityNone Compatibility = "NONE"
+	// CompatibilityBackward accepts the schema that can read data written by the latest schema of the subject
+	CompatibilityBackward Compatibility = "BACKWARD"
+)
+
+// Schema represents a schema that is registered to the schema registry.
+type Schema struct {
+	Type   SchemaType
+	Schema string
+}
+
+// SchemaRegistry registers and looks up schemas of the Confluent wire format, ids are global across subjects.
+type SchemaRegistry interface {
+	// Register registers the schema to the subject and returns its id, id of the schema is returned if it's already registered
+	Register(ctx context.Context, subject string, schema Schema) (int, error)
+	// LookupID returns the id of the schema that is registered to the subject
+	LookupID(ctx context.Context, subject string, schema Schema) (int, error)
+	// SchemaByID returns the schema of the id
+	SchemaByID(ctx context.Context, id int) (Schema, error)
+	// IsCompatible returns true if the schema is compatible with the latest schema of the subject, it's true when subject has no schema
+	IsCompatible(ctx context.Context, subject string, schema Schema) (bool, error)
+}
+
+// TopicValueSubject returns the subject of the message value of the topic by the topic name strategy.
+func TopicValueSubject(topic string) string {
+	return topic + "-value"
+}
+
+// memorySchemaRegistry is the schema registry that keeps schemas in memory, it's the stand-in of the schema registry
+// for tests and local development.
+type memorySchemaRegistry struct {
+	mu            sync.RWMutex
+	compatibility Compatibility
+	// schemas are indexed by id - 1
+	schemas  []Schema
+	subjects map[string][]int
+}
+
+// NewMemorySchemaRegistry creates the in-memory schema registry, compatibility is backward by default.
+func NewMemorySchemaRegistry() *memorySchemaRegistry {
+	return &memorySchemaRegistry{
+		compatibility: CompatibilityBackward,
+		subjects:      make(map[string][]int),
+	}
+}
+
+// SetCompatibility sets the compatibility level of every subject.
+func (r *memorySchemaRegistry) SetCompatibility(compatibility Compatibility) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.compatibility = compatibility
+}
+
+// Register registers the schema to the subject and returns its id.
+func (r *memorySchemaRegistry) Register(_ context.Context, subject string, schema Schema) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id, ok := r.lookupID(subject, schema); ok {
+		return id, nil
+	}
+	if err := r.checkCompatibility(subject, schema); err != nil {
+		return 0, err
+	}
+
+	id := slices.Index(r.schemas, schema) + 1
+	if id == 0 {
+		r.schemas = append(r.schemas, schema)
+		id = len(r.schemas)
+	}
+	r.subjects[subject] = append(r.subjects[subject], id)
+	return id, nil
+}
+
+// LookupID returns the id of the schema that is registered to the subject.
+func (r *memorySchemaRegistry) LookupID(_ context.Context, subject string, schema Schema) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if id, ok := r.lookupID(subject, schema); ok {
+		return id, nil
+	}
+	return 0, fmt.Errorf("%w: subject %s", ErrSchemaNotFound, subject)
+}
+
+// SchemaByID returns the schema of the id.
+func (r *memorySchemaRegistry) SchemaByID(_ context.Context, id int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if id < 1 || id > len(r.schemas) {
+		return Schema{}, fmt.Errorf("%w: id %d", ErrSchemaNotFound, id)
+	}
+	return r.schemas[id-1], nil
+}
+
+// IsCompatible returns true if the schema is compatible with the latest schema of the subject.
+func (r *memorySchemaRegistry) IsCompatible(_ context.Context, subject string, schema Schema) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	err := r.checkCompatibility(subject, schema)
+	if errors.Is(err, ErrIncompatibleSchema) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// lookupID returns the id of the schema if it's one of the versions of the subject.
+func (r *memorySchemaRegistry) lookupID(subject string, schema Schema) (int, bool) {
+	for _, id := range r.subjects[subject] {
+		if r.schemas[id-1] == schema {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// checkCompatibility checks the schema against the latest schema of the subject by the compatibility level.
+func (r *memorySchemaRegistry) checkCompatibility(subject string, schema Schema) error {
+	versions := r.subjects[subject]
+	if len(versions) == 0 {
+		return nil
+	}
+	return checkSchemaCompatibility(r.compatibility, r.schemas[versions[len(versions)-1]-1], schema)
+}
+
+// checkSchemaCompatibility returns error of ErrIncompatibleSchema if the schema is not compatible with the latest schema,
+// avro schemas are resolved against each other, schemas of other types are only checked by the type.
+func checkSchemaCompatibility(compatibility Compatibility, latest, schema Schema) error {
+	if latest.Type != schema.Type {
+		return fmt.Errorf("%w: schema type %s is changed to %s", ErrIncompatibleSchema, latest.Type, schema.Type)
+	}
+	if compatibility == CompatibilityNone || schema.Type != SchemaTypeAvro {
+		return nil
+	}
+
+	writer, err := parseAvroSchema(latest.Schema)
+	if err != nil {
+		return fmt.Errorf("invalid latest avro schema: %w", err)
+	}
+	reader, err := parseAvroSchema(schema.Schema)
+	if err != nil {
+		return fmt.Errorf("invalid avro schema: %w", err)
+	}
+	// backward compatible schema is able to read data written by the latest schema
+	if err := avro.NewSchemaCompatibility().Compatible(reader, writer); err != nil {
+		return fmt.Errorf("%w: %w", ErrIncompatibleSchema, err)
+	}
+	return nil
+}
+
+// parseAvroSchema parses the avro schema with its own cache so named types of other versions of the schema are not reused.
+func parseAvroSchema(schema string) (avro.Schema, error) {
+	return avro.ParseWithCache(schema, "", &avro.SchemaCache{})
+}
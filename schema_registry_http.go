@@ -0,0 +1,221 @@
+package tessara
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaRegistryContentType is the content type of the requests of the Confluent schema registry API
+const schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+// schemaRegistryErrorSubjectNotFound is the error code of the Confluent schema registry API when the subject is not registered
+const schemaRegistryErrorSubjectNotFound = 40401
+
+// SchemaRegistryError is returned when the schema registry responds with error, errors.Is matches its kind.
+type SchemaRegistryError struct {
+	StatusCode int
+	Code       int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+// Error returns the error message.
+func (e *SchemaRegistryError) Error() string {
+	return fmt.Sprintf("schema registry responded %d: %d %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Unwrap returns the kind of the error, it's nil when the error is not classified.
+func (e *SchemaRegistryError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		return ErrSchemaNotFound
+	case e.StatusCode == http.StatusConflict:
+		return ErrIncompatibleSchema
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrSchemaRegistryUnavailable
+	}
+	return nil
+}
+
+// httpSchemaRegistry is the client of the Confluent schema registry API, schemas and ids are cached since they're immutable.
+type httpSchemaRegistry struct {
+	baseURL            string
+	client             *http.Client
+	username, password string
+
+	// mu guards ids and schemas, ids are cached by subject and schema
+	mu      sync.RWMutex
+	ids     map[subjectSchema]int
+	schemas map[int]Schema
+}
+
+// subjectSchema is the cache key of the schema id
+type subjectSchema struct {
+	subject string
+	schema  Schema
+}
+
+// NewHTTPSchemaRegistry creates the client of the schema registry of the given url, requests are timed out after 10 seconds by default.
+func NewHTTPSchemaRegistry(baseURL string) *httpSchemaRegistry {
+	return &httpSchemaRegistry{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		ids:     make(map[subjectSchema]int),
+		schemas: make(map[int]Schema),
+	}
+}
+
+// WithBasicAuth sets the credentials of the schema registry, it has to be called before the client is used.
+func (r *httpSchemaRegistry) WithBasicAuth(username, password string) *httpSchemaRegistry {
+	r.username, r.password = username, password
+	return r
+}
+
+// WithHTTPClient sets the http client of the requests, it has to be called before the client is used.
+func (r *httpSchemaRegistry) WithHTTPClient(client *http.Client) *httpSchemaRegistry {
+	r.client = client
+	return r
+}
+
+// schemaRequest is the request and response body of the schema
+type schemaRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+// toSchemaRequest converts the schema to the request body, schema type is omitted for avro because it's the default
+func toSchemaRequest(schema Schema) schemaRequest {
+	req := schemaRequest{Schema: schema.Schema}
+	if schema.Type != SchemaTypeAvro {
+		req.SchemaType = string(schema.Type)
+	}
+	return req
+}
+
+// Register registers the schema to the subject and returns its id.
+func (r *httpSchemaRegistry) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	if id, ok := r.cachedID(subject, schema); ok {
+		return id, nil
+	}
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := r.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", toSchemaRequest(schema), &resp); err != nil {
+		return 0, fmt.Errorf("unable to register schema of subject %s: %w", subject, err)
+	}
+	r.cache(subject, schema, resp.ID)
+	return resp.ID, nil
+}
+
+// LookupID returns the id of the schema that is registered to the subject.
+func (r *httpSchemaRegistry) LookupID(ctx context.Context, subject string, schema Schema) (int, error) {
+	if id, ok := r.cachedID(subject, schema); ok {
+		return id, nil
+	}
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := r.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject), toSchemaRequest(schema), &resp); err != nil {
+		return 0, fmt.Errorf("unable to look up schema of subject %s: %w", subject, err)
+	}
+	r.cache(subject, schema, resp.ID)
+	return resp.ID, nil
+}
+
+// SchemaByID returns the schema of the id.
+func (r *httpSchemaRegistry) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	r.mu.RLock()
+	schema, ok := r.schemas[id]
+	r.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	var resp schemaRequest
+	if err := r.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp); err != nil {
+		return Schema{}, fmt.Errorf("unable to get schema of id %d: %w", id, err)
+	}
+	schema = Schema{Type: SchemaTypeAvro, Schema: resp.Schema}
+	if resp.SchemaType != "" {
+		schema.Type = SchemaType(resp.SchemaType)
+	}
+	r.mu.Lock()
+	r.schemas[id] = schema
+	r.mu.Unlock()
+	return schema, nil
+}
+
+// IsCompatible returns true if the schema is compatible with the latest schema of the subject, it's true when subject has no schema.
+func (r *httpSchemaRegistry) IsCompatible(ctx context.Context, subject string, schema Schema) (bool, error) {
+	var resp struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	err := r.do(ctx, http.MethodPost, "/compatibility/subjects/"+url.PathEscape(subject)+"/versions/latest", toSchemaRequest(schema), &resp)
+	var srErr *SchemaRegistryError
+	if errors.As(err, &srErr) && srErr.Code == schemaRegistryErrorSubjectNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to check compatibility of subject %s: %w", subject, err)
+	}
+	return resp.IsCompatible, nil
+}
+
+// cachedID returns the cached id of the schema of the subject.
+func (r *httpSchemaRegistry) cachedID(subject string, schema Schema) (int, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.ids[subjectSchema{subject: subject, schema: schema}]
+	return id, ok
+}
+
+// cache caches the id of the schema of the subject and the schema of the id.
+func (r *httpSchemaRegistry) cache(subject string, schema Schema, id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids[subjectSchema{subject: subject, schema: schema}] = id
+	r.schemas[id] = schema
+}
+
+// do sends the request to the schema registry and decodes the response into out, error response is returned as SchemaRegistryError.
+func (r *httpSchemaRegistry) do(ctx context.Context, method, path string, in, out any) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", schemaRegistryContentType)
+	if in != nil {
+		req.Header.Set("Content-Type", schemaRegistryContentType)
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSchemaRegistryUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		srErr := &SchemaRegistryError{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(srErr); err != nil {
+			srErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return srErr
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
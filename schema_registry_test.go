@@ -0,0 +1,164 @@
+package tessara
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	orderAvroSchemaV1 = `{"type":"record","name":"Order","fields":[{"name":"id","type":"string"}]}`
+	orderAvroSchemaV2 = `{"type":"record","name":"Order","fields":[{"name":"id","type":"string"},{"name":"amount","type":"int","default":0}]}`
+)
+
+type orderV1 struct {
+	ID string `avro:"id"`
+}
+
+type orderV2 struct {
+	ID     string `avro:"id"`
+	Amount int    `avro:"amount"`
+}
+
+func TestMemorySchemaRegistryChecksBackwardCompatibility(t *testing.T) {
+	sr := NewMemorySchemaRegistry()
+	ctx := context.Background()
+
+	id, err := sr.Register(ctx, "orders-value", Schema{Type: SchemaTypeAvro, Schema: orderAvroSchemaV1})
+	assert.NoError(t, err)
+	again, _ := sr.Register(ctx, "orders-value", Schema{Type: SchemaTypeAvro, Schema: orderAvroSchemaV1})
+	assert.Equal(t, id, again)
+
+	// new field without default can not read data written by the latest schema
+	noDefault := Schema{Type: SchemaTypeAvro, Schema: `{"type":"record","name":"Order","fields":[{"name":"id","type":"string"},{"name":"amount","type":"int"}]}`}
+	compatible, err := sr.IsCompatible(ctx, "orders-value", noDefault)
+	assert.NoError(t, err)
+	assert.False(t, compatible)
+	_, err = sr.Register(ctx, "orders-value", noDefault)
+	assert.ErrorIs(t, err, ErrIncompatibleSchema)
+
+	compatible, _ = sr.IsCompatible(ctx, "orders-value", Schema{Type: SchemaTypeAvro, Schema: orderAvroSchemaV2})
+	assert.True(t, compatible)
+	_, err = sr.SchemaByID(ctx, 99)
+	assert.ErrorIs(t, err, ErrSchemaNotFound)
+}
+
+func TestAvroSchemaCodecResolvesOlderSchema(t *testing.T) {
+	sr := NewMemorySchemaRegistry()
+	v1, err := NewAvroSchemaCodec[orderV1](sr, TopicValueSubject("orders"), orderAvroSchemaV1)
+	assert.NoError(t, err)
+	v2, err := NewAvroSchemaCodec[orderV2](sr, TopicValueSubject("orders"), orderAvroSchemaV2)
+	assert.NoError(t, err)
+
+	data, err := v1.Encode(orderV1{ID: "order-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 1}, data[:wireFormatHeaderSize])
+
+	decoded, err := v2.Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, orderV2{ID: "order-1"}, decoded)
+
+	_, err = v2.Decode([]byte("not wire format"))
+	assert.ErrorIs(t, err, ErrWireFormat)
+}
+
+func TestSchemaCodecsRoundTrip(t *testing.T) {
+	sr := NewMemorySchemaRegistry()
+
+	pc := NewProtobufSchemaCodec[*wrapperspb.StringValue](sr, "names-value", `syntax = "proto3"; message StringValue { string value = 1; }`)
+	data, err := pc.Encode(wrapperspb.String("order-1"))
+	assert.NoError(t, err)
+	// first message index is written as a single 0 after the header
+	assert.Equal(t, byte(0), data[wireFormatHeaderSize])
+	decoded, err := pc.Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "order-1", decoded.GetValue())
+
+	jc := NewJSONSchemaCodec[order](sr, "orders-value", `{"type":"object"}`)
+	data, err = jc.Encode(order{ID: "order-1", Amount: 100})
+	assert.NoError(t, err)
+	decodedOrder, err := jc.Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, order{ID: "order-1", Amount: 100}, decodedOrder)
+
+	_, err = NewJSONSchemaCodec[order](sr, "unknown-value", `{"type":"object"}`).WithoutAutoRegister().Encode(order{})
+	assert.ErrorIs(t, err, ErrSchemaNotFound)
+}
+
+func TestHTTPSchemaRegistryCachesSchemas(t *testing.T) {
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /subjects/{subject}/versions", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var req schemaRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "PROTOBUF", req.SchemaType)
+		_, _ = w.Write([]byte(`{"id":7}`))
+	})
+	mux.HandleFunc("GET /schemas/ids/{id}", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.PathValue("id") != strconv.Itoa(8) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"schema":"{\"type\":\"string\"}"}`))
+	})
+	mux.HandleFunc("POST /compatibility/subjects/{subject}/versions/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error_code":40401,"message":"Subject not found"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	sr := NewHTTPSchemaRegistry(server.URL)
+	ctx := context.Background()
+	schema := Schema{Type: SchemaTypeProtobuf, Schema: `syntax = "proto3";`}
+
+	compatible, err := sr.IsCompatible(ctx, "orders-value", schema)
+	assert.NoError(t, err)
+	assert.True(t, compatible)
+	for range 2 {
+		id, err := sr.Register(ctx, "orders-value", schema)
+		assert.NoError(t, err)
+		assert.Equal(t, 7, id)
+		got, err := sr.SchemaByID(ctx, 7)
+		assert.NoError(t, err)
+		assert.Equal(t, schema, got)
+	}
+	got, err := sr.SchemaByID(ctx, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, Schema{Type: SchemaTypeAvro, Schema: `{"type":"string"}`}, got)
+	assert.Equal(t, 2, requests)
+
+	_, err = sr.SchemaByID(ctx, 9)
+	assert.ErrorIs(t, err, ErrSchemaNotFound)
+}
+
+func TestTypedConsumerCancelsSchemaRegistryCallWithMessageContext(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /schemas/ids/{id}", func(w http.ResponseWriter, r *http.Request) {
+		// registry is unavailable until the request is cancelled
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	codec := NewJSONSchemaCodec[order](NewHTTPSchemaRegistry(server.URL), "orders-value", `{"type":"object"}`)
+	adapter := typedHandlerAdapter[order]{codec: codec}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := adapter.Perform(ctx, PerformMessage{Value: []byte{0, 0, 0, 0, 1, '{', '}'}})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, ErrSchemaRegistryUnavailable)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -2,6 +2,8 @@ package tessara
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/IBM/sarama"
@@ -14,6 +16,15 @@ import (
 type subqueueMessage struct {
 	consumerMessage *sarama.ConsumerMessage
 	messageBuffer   *messageBuffer
+	trace           messageTrace
+}
+
+// inFlightMessage represents the message that subqueue is handling, size is the number of messages of the batch
+type inFlightMessage struct {
+	offset    int64
+	key       string
+	size      int
+	startedAt time.Time
 }
 
 // subqueue represents a subqueue that receives messages from the receiver channel and push to subqueue handler
@@ -23,6 +34,24 @@ type subqueue struct {
 	retryableHandler retryableHandler
 
 	pushMessageBlockingInterval time.Duration
+	// inFlight is the message or the first message of the batch that subqueue is handling, it's nil when subqueue is idle
+	inFlight atomic.Pointer[inFlightMessage]
+	// saturatedSince is the unix nano that push starts blocking because subqueue is full, it's 0 when subqueue is not saturated
+	saturatedSince atomic.Int64
+
+	// batch config, only used when retryable handler is handling batch of messages
+	batchMaxSize   int
+	batchMaxLinger time.Duration
+
+	// failure policy config, failure error channel receives error when partition is stopped by failure policy
+	failurePolicy    FailurePolicy
+	failureErrorChan chan error
+
+	logger  logger.Logger
+	metrics metric.PartitionMetrics
+
+	// done is closed once the subqueue is stopped by the context
+	done chan struct{}
 }
 
 // newSubqueue creates a new subqueue instance
@@ -31,21 +60,40 @@ func newSubqueue(ctx context.Context,
 	rh retryableHandler,
 	memoryBufferSize uint64,
 	pushMessageBlockingInterval time.Duration,
+	batchMaxSize int,
+	batchMaxLinger time.Duration,
+	failurePolicy FailurePolicy,
+	failureErrorChan chan error,
+	l logger.Logger,
+	pm metric.PartitionMetrics,
 ) *subqueue {
 	subqueueChannelBufferSize := memoryBufferSize
+	l = l.With("subqueue", id)
 	sq := &subqueue{
 		id:                          id,
 		receiver:                    make(chan subqueueMessage, subqueueChannelBufferSize),
-		retryableHandler:            rh.withFromSubqueueID(id),
+		retryableHandler:            rh.withFromSubqueueID(id).withLogger(l).withMetrics(pm),
 		pushMessageBlockingInterval: pushMessageBlockingInterval,
+		batchMaxSize:                batchMaxSize,
+		batchMaxLinger:              batchMaxLinger,
+		failurePolicy:               failurePolicy,
+		failureErrorChan:            failureErrorChan,
+		logger:                      l,
+		metrics:                     pm,
+		done:                        make(chan struct{}),
 	}
 
 	go func() {
+		defer close(sq.done)
+		if sq.retryableHandler.IsBatch() {
+			sq.startHandleBatch(ctx)
+			return
+		}
 		sq.startHandleMessage(ctx)
 	}()
 
 	// update metric
-	metric.UpdateSubqueueChannelBufferSize(subqueueChannelBufferSize)
+	sq.metrics.UpdateSubqueueChannelBufferSize(subqueueChannelBufferSize)
 
 	return sq
 }
@@ -56,33 +104,48 @@ func newSubqueues(ctx context.Context,
 	memoryBufferSize uint64,
 	pushMessageBlockingInterval time.Duration,
 	subqueueNumber int,
+	batchMaxSize int,
+	batchMaxLinger time.Duration,
+	failurePolicy FailurePolicy,
+	failureErrorChan chan error,
+	l logger.Logger,
+	pm metric.PartitionMetrics,
 ) []*subqueue {
 	var sqs []*subqueue
 	for i := range subqueueNumber {
-		sqs = append(sqs, newSubqueue(ctx, i+1, rh, memoryBufferSize, pushMessageBlockingInterval))
+		sqs = append(sqs, newSubqueue(ctx, i+1, rh, memoryBufferSize, pushMessageBlockingInterval, batchMaxSize, batchMaxLinger, failurePolicy, failureErrorChan, l, pm))
 		// update metric
-		metric.InitSubqueueMessageProcessingCount(i + 1)
-		metric.InitSubqueueMessageProcessedCount(i + 1)
-		metric.InitSubqueueMessageErrorCount(i + 1)
+		pm.InitSubqueue(i+1, string(failurePolicy))
 	}
-	metric.SetSubqueueCount(subqueueNumber)
+	pm.SetSubqueueCount(subqueueNumber)
 	return sqs
 }
 
-// Push pushes a subqueue message to the subqueue receiver channel
-func (s *subqueue) Push(ctx context.Context, sqMsg subqueueMessage) {
+// Push pushes a subqueue message to the subqueue receiver channel, it returns the context error when context is done before it's pushed
+func (s *subqueue) Push(ctx context.Context, sqMsg subqueueMessage) error {
+	defer s.saturatedSince.Store(0)
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return ctx.Err()
 		case s.receiver <- sqMsg:
-			return
+			return nil
 		default:
+			s.saturatedSince.CompareAndSwap(0, time.Now().UnixNano())
 			time.Sleep(s.pushMessageBlockingInterval)
 		}
 	}
 }
 
+// saturatedFor returns how long push has been blocked because subqueue is full
+func (s *subqueue) saturatedFor() time.Duration {
+	since := s.saturatedSince.Load()
+	if since == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, since))
+}
+
 // startHandleMessage starts handling messages from the subqueue receiver channel
 func (s *subqueue) startHandleMessage(ctx context.Context) {
 	for {
@@ -93,28 +156,231 @@ func (s *subqueue) startHandleMessage(ctx context.Context) {
 			if !ok {
 				return
 			}
-			start := time.Now()
-			metric.IncrementSubqueueMessageProcessingCount(s.id)
+			if err := s.handleMessage(ctx, msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleMessage performs the message, it returns error only when the context is cancelled, message is not marked success then
+func (s *subqueue) handleMessage(ctx context.Context, msg subqueueMessage) error {
+	start := time.Now()
+	s.metrics.IncrementSubqueueMessageProcessingCount(s.id)
+	// message is no longer processing once it's returned whether it's succeeded, failed or left uncommitted
+	defer s.metrics.DecrementSubqueueMessageProcessingCount(s.id)
+	msg.trace.endSubqueueWait(s.id)
+	s.inFlight.Store(&inFlightMessage{offset: msg.consumerMessage.Offset, key: string(msg.consumerMessage.Key), size: 1, startedAt: start})
+	defer s.inFlight.Store(nil)
+
+	s.logger.Debug("handling message", "offset", msg.consumerMessage.Offset)
+
+	// wait until retry delay is passed, it's only for messages from retry topic
+	if err := waitRetryDue(ctx, msg.consumerMessage); err != nil {
+		msg.trace.end(err)
+		return err
+	}
+
+	// perform
+	msgCtx := msg.trace.contextWithTrace(newMessageContext(ctx, msg.consumerMessage))
+	if s.retryableHandler.IsTransform() {
+		msgCtx = withOutputBuffer(msgCtx, msg.messageBuffer)
+	}
+	err := s.retryableHandler.Perform(msgCtx, toPerformMessage(msg.consumerMessage))
+	defer msg.trace.end(err)
+	if err != nil && ctx.Err() != nil {
+		// claim is ended, message is left uncommitted to be reprocessed by the next owner of the partition
+		return ctx.Err()
+	}
+	if err != nil && !s.handleFailure(msgCtx, msg, err) {
+		return nil
+	}
+	msg.messageBuffer.MarkSuccess()
+	s.logger.Debug("message proceeded and marked successfully", "offset", msg.consumerMessage.Offset)
+
+	elapse := time.Since(start)
+	s.metrics.ObserveSubqueueMessageProcessingTime(elapse)
+	s.metrics.IncrementSubqueueMessageProcessedCount(s.id)
+	return nil
+}
+
+// startHandleBatch starts collecting messages from the subqueue receiver channel into a batch,
+// batch is handled once it reaches batch max size or batch max linger is passed since the first message of the batch
+func (s *subqueue) startHandleBatch(ctx context.Context) {
+	batch := make([]subqueueMessage, 0, s.batchMaxSize)
+	lingerTimer := time.NewTimer(s.batchMaxLinger)
+	lingerTimer.Stop()
+	defer lingerTimer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-s.receiver:
+			if !ok {
+				return
+			}
+			if len(batch) == 0 {
+				lingerTimer.Reset(s.batchMaxLinger)
+			}
+			batch = append(batch, msg)
+			if len(batch) < s.batchMaxSize {
+				continue
+			}
+		case <-lingerTimer.C:
+		}
 
-			logger.Debug().
-				Any("message", msg.consumerMessage.Value).
-				Msg("handling message")
+		lingerTimer.Stop()
+		if len(batch) == 0 {
+			continue
+		}
+		s.handleBatch(ctx, batch)
+		batch = make([]subqueueMessage, 0, s.batchMaxSize)
+	}
+}
+
+// handleBatch performs the batch of messages, every message in the batch is marked success only when the whole batch succeeds
+func (s *subqueue) handleBatch(ctx context.Context, batch []subqueueMessage) {
+	start := time.Now()
+	pms := make([]PerformMessage, 0, len(batch))
+	for _, msg := range batch {
+		msg.trace.endSubqueueWait(s.id)
+	}
+	s.inFlight.Store(&inFlightMessage{offset: batch[0].consumerMessage.Offset, key: string(batch[0].consumerMessage.Key), size: len(batch), startedAt: start})
+	defer s.inFlight.Store(nil)
+	// messages counted as processing are no longer processing once the batch is returned
+	defer func() {
+		for range pms {
+			s.metrics.DecrementSubqueueMessageProcessingCount(s.id)
+		}
+	}()
+	for _, msg := range batch {
+		// wait until retry delay is passed, it's only for messages from retry topic
+		if err := waitRetryDue(ctx, msg.consumerMessage); err != nil {
+			endBatchTrace(nil, batch, err)
+			return
+		}
+		s.metrics.IncrementSubqueueMessageProcessingCount(s.id)
+		pms = append(pms, toPerformMessage(msg.consumerMessage))
+	}
+
+	s.logger.Debug("handling batch",
+		"size", len(batch),
+		"offset", batch[0].consumerMessage.Offset,
+	)
+
+	// perform
+	batchCtx, batchSpan := s.retryableHandler.tracer.startBatch(ctx, batch)
+	err := s.retryableHandler.PerformBatch(batchCtx, pms)
+	defer endBatchTrace(batchSpan, batch, err)
+	if err != nil && ctx.Err() != nil {
+		// claim is ended, messages are left uncommitted to be reprocessed by the next owner of the partition
+		return
+	}
+	if err != nil {
+		s.handleBatchFailure(batchCtx, batch, pms, err)
+		return
+	}
+	for _, msg := range batch {
+		msg.messageBuffer.MarkSuccess()
+	}
+	s.logger.Debug("batch proceeded and marked successfully",
+		"size", len(batch),
+		"offset", batch[0].consumerMessage.Offset,
+	)
+
+	elapse := time.Since(start)
+	s.metrics.ObserveSubqueueMessageProcessingTime(elapse)
+	for range batch {
+		s.metrics.IncrementSubqueueMessageProcessedCount(s.id)
+	}
+}
+
+// handleFailure routes the message that run out of retries to the retry or dead letter topic, otherwise it calls the fallback
+// and applies the failure policy, it returns true when the message can be marked success
+func (s *subqueue) handleFailure(ctx context.Context, msg subqueueMessage, err error) bool {
+	if s.retryableHandler.HasFailureRoute(err) {
+		// message is marked success only after the retry or dead letter record is acknowledged
+		routeErr := s.retryableHandler.RouteFailure(ctx, msg.consumerMessage, err)
+		if routeErr == nil {
+			s.logger.Info("message published to retry or dead letter topic",
+				"offset", msg.consumerMessage.Offset,
+				"error", unwrapExhaustedError(err),
+			)
+			return true
+		}
+		err = errors.Join(unwrapExhaustedError(err), routeErr)
+	}
+	s.logger.Error("perform message failed calling fallback",
+		"offset", msg.consumerMessage.Offset,
+		"failure_policy", s.failurePolicy,
+		"error", unwrapExhaustedError(err),
+	)
+	s.retryableHandler.Fallback(ctx, toPerformMessage(msg.consumerMessage), err)
+	return s.applyFailurePolicy(ctx, err)
+}
 
-			// perform
-			err := s.retryableHandler.Perform(toPerformMessage(msg.consumerMessage))
-			if err != nil {
-				s.retryableHandler.Fallback(toPerformMessage(msg.consumerMessage), err)
+// handleBatchFailure publishes every message of the failed batch to the retry or dead letter topic, published messages are marked success
+// and messages that unable to publish are passed to the fallback then the failure policy is applied
+func (s *subqueue) handleBatchFailure(ctx context.Context, batch []subqueueMessage, pms []PerformMessage, err error) {
+	failedBatch, failedPms := batch, pms
+	if s.retryableHandler.HasFailureRoute(err) {
+		failedBatch, failedPms = nil, nil
+		routeErrs := []error{unwrapExhaustedError(err)}
+		for i, msg := range batch {
+			if routeErr := s.retryableHandler.RouteFailure(msg.trace.contextWithTrace(ctx), msg.consumerMessage, err); routeErr != nil {
+				failedBatch = append(failedBatch, msg)
+				failedPms = append(failedPms, pms[i])
+				routeErrs = append(routeErrs, routeErr)
 				continue
 			}
 			msg.messageBuffer.MarkSuccess()
-			logger.Debug().
-				Any("message", msg.consumerMessage.Value).
-				Msg("message proceeded and marked successfully")
-
-			elapse := time.Since(start)
-			metric.UpdateSubqueueMessageProcessingTime(elapse)
-			metric.IncrementSubqueueMessageProcessedCount(s.id)
-			metric.DecrementSubqueueMessageProcessingCount(s.id)
+		}
+		if len(failedBatch) == 0 {
+			return
+		}
+		err = errors.Join(routeErrs...)
+	}
+
+	s.logger.Error("perform batch failed calling fallback",
+		"size", len(failedBatch),
+		"offset", failedBatch[0].consumerMessage.Offset,
+		"failure_policy", s.failurePolicy,
+		"error", unwrapExhaustedError(err),
+	)
+	s.retryableHandler.FallbackBatch(ctx, failedPms, err)
+	if s.applyFailurePolicy(ctx, err) {
+		for _, msg := range failedBatch {
+			msg.messageBuffer.MarkSuccess()
+		}
+	}
+}
+
+// applyFailurePolicy applies the failure policy to the message that fallback is called, it returns true when the message can be marked success
+func (s *subqueue) applyFailurePolicy(ctx context.Context, err error) bool {
+	s.metrics.IncrementSubqueueMessageFailureCount(s.id, string(s.failurePolicy))
+	switch s.failurePolicy {
+	case FailurePolicyMarkDone:
+		return true
+	case FailurePolicyStopPartition:
+		s.pushErrorToFailureErrorChannel(ctx, err)
+		return false
+	default:
+		// block, message is not marked so watermark stays until commit give up restarts the claim
+		return false
+	}
+}
+
+// pushErrorToFailureErrorChannel pushes error to failure error channel to stop the partition
+func (s *subqueue) pushErrorToFailureErrorChannel(ctx context.Context, err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s.failureErrorChan <- err:
+			return
+		default:
+			time.Sleep(s.pushMessageBlockingInterval)
 		}
 	}
 }
@@ -1,6 +1,7 @@
 package tessara
 
 import (
+	"context"
 	"time"
 
 	"github.com/IBM/sarama"
@@ -12,23 +13,107 @@ type messageHandler interface {
 	Fallback(PerformMessage, error)
 }
 
+// contextMessageHandler is an interface for handling messages from subqueue with context,
+// context is cancelled when the claim ends (rebalance or shutdown) or handler timeout is passed
+type contextMessageHandler interface {
+	Perform(context.Context, PerformMessage) error
+	Fallback(context.Context, PerformMessage, error)
+}
+
+// messageHandlerAdapter adapts the message handler to the context message handler, context is ignored
+type messageHandlerAdapter struct {
+	messageHandler messageHandler
+}
+
+// Perform calls perform of the message handler
+func (a messageHandlerAdapter) Perform(_ context.Context, pm PerformMessage) error {
+	return a.messageHandler.Perform(pm)
+}
+
+// Fallback calls fallback of the message handler
+func (a messageHandlerAdapter) Fallback(_ context.Context, pm PerformMessage, err error) {
+	a.messageHandler.Fallback(pm, err)
+}
+
+// transformMessageHandler is an interface for handling messages of the consume-transform-produce pipeline,
+// messages returned by Transform are produced in the same transaction that commits the offset of the consumed message
+type transformMessageHandler interface {
+	Transform(context.Context, PerformMessage) ([]ProducerMessage, error)
+	Fallback(context.Context, PerformMessage, error)
+}
+
+// transformHandlerAdapter adapts the transform message handler to the context message handler,
+// outputs are kept in the message buffer carried by the context until they're produced by the committer
+type transformHandlerAdapter struct {
+	transformMessageHandler transformMessageHandler
+}
+
+// Perform calls transform of the transform message handler and keeps its outputs
+func (a transformHandlerAdapter) Perform(ctx context.Context, pm PerformMessage) error {
+	outputs, err := a.transformMessageHandler.Transform(ctx, pm)
+	if err != nil {
+		return err
+	}
+	if mb, ok := outputBufferFromContext(ctx); ok {
+		mb.setOutputs(outputs)
+	}
+	return nil
+}
+
+// Fallback calls fallback of the transform message handler
+func (a transformHandlerAdapter) Fallback(ctx context.Context, pm PerformMessage, err error) {
+	a.transformMessageHandler.Fallback(ctx, pm, err)
+}
+
+// batchMessageHandler is an interface for handling batch of messages from subqueue
+type batchMessageHandler interface {
+	PerformBatch([]PerformMessage) error
+	FallbackBatch([]PerformMessage, error)
+}
+
+// contextBatchMessageHandler is an interface for handling batch of messages from subqueue with context,
+// context is cancelled when the claim ends (rebalance or shutdown) or handler timeout is passed
+type contextBatchMessageHandler interface {
+	PerformBatch(context.Context, []PerformMessage) error
+	FallbackBatch(context.Context, []PerformMessage, error)
+}
+
+// batchMessageHandlerAdapter adapts the batch message handler to the context batch message handler, context is ignored
+type batchMessageHandlerAdapter struct {
+	batchMessageHandler batchMessageHandler
+}
+
+// PerformBatch calls perform batch of the batch message handler
+func (a batchMessageHandlerAdapter) PerformBatch(_ context.Context, pms []PerformMessage) error {
+	return a.batchMessageHandler.PerformBatch(pms)
+}
+
+// FallbackBatch calls fallback batch of the batch message handler
+func (a batchMessageHandlerAdapter) FallbackBatch(_ context.Context, pms []PerformMessage, err error) {
+	a.batchMessageHandler.FallbackBatch(pms, err)
+}
+
 // PerformMessage represents a message to be processed by a SubQueueHandler.
 type PerformMessage struct {
-	Key, Value []byte
-	Topic      string
-	Partition  int32
-	Offset     int64
-	Timestamp  time.Time // only set if kafka is version 0.10+
+	Key, Value     []byte
+	Headers        Headers // only set if kafka is version 0.11+
+	Topic          string
+	Partition      int32
+	Offset         int64
+	Timestamp      time.Time // only set if kafka is version 0.10+
+	BlockTimestamp time.Time // only set if kafka is version 0.10+, outer (compressed) block timestamp
 }
 
 // toPerformMessage converts a sarama.ConsumerMessage to a PerformMessage.
 func toPerformMessage(cm *sarama.ConsumerMessage) PerformMessage {
 	return PerformMessage{
-		Key:       cm.Key,
-		Value:     cm.Value,
-		Topic:     cm.Topic,
-		Partition: cm.Partition,
-		Offset:    cm.Offset,
-		Timestamp: cm.Timestamp,
+		Key:            cm.Key,
+		Value:          cm.Value,
+		Headers:        fromSaramaHeaders(cm.Headers),
+		Topic:          cm.Topic,
+		Partition:      cm.Partition,
+		Offset:         cm.Offset,
+		Timestamp:      cm.Timestamp,
+		BlockTimestamp: cm.BlockTimestamp,
 	}
 }
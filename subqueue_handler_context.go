@@ -0,0 +1,58 @@
+package tessara
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+)
+
+// messageContextKey is the context key of the message values
+type messageContextKey struct{}
+
+// messageContextValue represents the message values carried by the context given to the context message handler
+type messageContextValue struct {
+	topic     string
+	partition int32
+	offset    int64
+}
+
+// newMessageContext creates a context carrying topic, partition and offset of the consumer message
+func newMessageContext(ctx context.Context, cm *sarama.ConsumerMessage) context.Context {
+	return context.WithValue(ctx, messageContextKey{}, messageContextValue{
+		topic:     cm.Topic,
+		partition: cm.Partition,
+		offset:    cm.Offset,
+	})
+}
+
+// outputBufferContextKey is the context key of the message buffer that keeps the outputs of the transform message handler
+type outputBufferContextKey struct{}
+
+// withOutputBuffer creates a context carrying the message buffer that keeps the outputs of the transform message handler
+func withOutputBuffer(ctx context.Context, mb *messageBuffer) context.Context {
+	return context.WithValue(ctx, outputBufferContextKey{}, mb)
+}
+
+// outputBufferFromContext returns the message buffer that keeps the outputs of the transform message handler
+func outputBufferFromContext(ctx context.Context) (*messageBuffer, bool) {
+	mb, ok := ctx.Value(outputBufferContextKey{}).(*messageBuffer)
+	return mb, ok
+}
+
+// TopicFromContext returns the topic of the message that is handling with the context.
+func TopicFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(messageContextKey{}).(messageContextValue)
+	return v.topic, ok
+}
+
+// PartitionFromContext returns the partition of the message that is handling with the context.
+func PartitionFromContext(ctx context.Context) (int32, bool) {
+	v, ok := ctx.Value(messageContextKey{}).(messageContextValue)
+	return v.partition, ok
+}
+
+// OffsetFromContext returns the offset of the message that is handling with the context.
+func OffsetFromContext(ctx context.Context) (int64, bool) {
+	v, ok := ctx.Value(messageContextKey{}).(messageContextValue)
+	return v.offset, ok
+}
@@ -1,78 +1,327 @@
 package tessara
 
 import (
+	"context"
+	"errors"
 	"time"
 
+	"github.com/IBM/sarama"
 	"github.com/cenkalti/backoff"
+	"go.opentelemetry.io/otel"
 
 	"github.com/mrbryside/tessara/logger"
 	"github.com/mrbryside/tessara/metric"
 )
 
-// retryableHandler configures the consumer to start consuming from the newest offset.
+// retryableHandler wraps the message handler or batch message handler with retry backoff.
 type retryableHandler struct {
-	messageHandler  messageHandler
-	maxRetry        int
-	retryMultiplier float64
-	fromSubqueueID  int
+	messageHandler      contextMessageHandler
+	batchMessageHandler contextBatchMessageHandler
+	retryPolicy         RetryPolicy
+	handlerTimeout      time.Duration
+	fromSubqueueID      int
+	retryTopicPublisher *retryTopicPublisher
+	deadLetterPublisher *deadLetterPublisher
+	errorHandler        errorHandler
+	logger              logger.Logger
+	metrics             metric.PartitionMetrics
+	tracer              messageTracer
 }
 
-// newRetryableHandler configures the consumer to start consuming from the newest offset.
-func newRetryableHandler(messageHandler messageHandler, maxRetry int, retryMultiplier float64) retryableHandler {
+// exhaustedError represents the error of a message that run out of retries.
+type exhaustedError struct {
+	err           error
+	attempts      int
+	firstFailedAt time.Time
+}
+
+// Error returns the error of the last attempt.
+func (e *exhaustedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *exhaustedError) Unwrap() error {
+	return e.err
+}
+
+// asExhaustedError returns the exhausted error if the error is an exhausted error.
+func asExhaustedError(err error) (*exhaustedError, bool) {
+	var ee *exhaustedError
+	ok := errors.As(err, &ee)
+	return ee, ok
+}
+
+// unwrapExhaustedError returns the error of the last attempt if the error is an exhausted error.
+func unwrapExhaustedError(err error) error {
+	if ee, ok := asExhaustedError(err); ok {
+		return ee.err
+	}
+	return err
+}
+
+// newRetryableHandler creates a retryable handler for the message handler, handler timeout is applied to each perform attempt.
+func newRetryableHandler(messageHandler contextMessageHandler, retryPolicy RetryPolicy, handlerTimeout time.Duration) retryableHandler {
 	return retryableHandler{
-		messageHandler:  messageHandler,
-		maxRetry:        maxRetry,
-		retryMultiplier: retryMultiplier,
+		messageHandler: messageHandler,
+		retryPolicy:    retryPolicy,
+		handlerTimeout: handlerTimeout,
+		logger:         logger.Default(),
+		metrics:        metric.Discard(),
+		tracer:         newMessageTracer(otel.GetTracerProvider(), ""),
 	}
 }
 
-// retryableHandler configures the consumer to start consuming from the newest offset.
-func (h retryableHandler) Perform(pm PerformMessage) error {
-	switch h.maxRetry {
-	case 0:
-		return h.performWithoutRetry(pm)
-	default:
-		return h.performWithRetry(pm)
+// newBatchRetryableHandler creates a retryable handler for the batch message handler, handler timeout is applied to each perform attempt of the batch.
+func newBatchRetryableHandler(batchMessageHandler contextBatchMessageHandler, retryPolicy RetryPolicy, handlerTimeout time.Duration) retryableHandler {
+	return retryableHandler{
+		batchMessageHandler: batchMessageHandler,
+		retryPolicy:         retryPolicy,
+		handlerTimeout:      handlerTimeout,
+		logger:              logger.Default(),
+		metrics:             metric.Discard(),
+		tracer:              newMessageTracer(otel.GetTracerProvider(), ""),
 	}
 }
 
-// Fallback configures the consumer to start consuming from the newest offset.
-func (h retryableHandler) Fallback(pm PerformMessage, err error) {
-	h.messageHandler.Fallback(pm, err)
+// IsBatch returns true if the handler is handling batch of messages.
+func (h retryableHandler) IsBatch() bool {
+	return h.batchMessageHandler != nil
+}
+
+// IsTransform returns true if the handler is transforming messages into outputs that are produced by the committer.
+func (h retryableHandler) IsTransform() bool {
+	_, ok := h.messageHandler.(transformHandlerAdapter)
+	return ok
 }
 
-// performWithoutRetry configures the consumer to start consuming from the newest offset.
-func (h retryableHandler) performWithoutRetry(pm PerformMessage) error {
-	return h.messageHandler.Perform(pm)
+// Perform performs the message with retry if max retry is set.
+func (h retryableHandler) Perform(ctx context.Context, pm PerformMessage) error {
+	attempt := 0
+	return h.perform(ctx, h.logger.With("offset", pm.Offset), func() error {
+		attempt++
+		attemptCtx, cancel := h.withHandlerTimeout(ctx)
+		defer cancel()
+		attemptCtx, span := h.tracer.start(attemptCtx, "tessara.perform", h.tracer.performAttributes(pm, h.fromSubqueueID, attributePerformAttempt.Int(attempt))...)
+		err := h.recoverPanic(pm, func() error {
+			return h.messageHandler.Perform(attemptCtx, pm)
+		})
+		endSpan(span, err)
+		return err
+	})
+}
+
+// PerformBatch performs the batch of messages with retry if max retry is set, whole batch is retried on error.
+func (h retryableHandler) PerformBatch(ctx context.Context, pms []PerformMessage) error {
+	attempt := 0
+	return h.perform(ctx, h.logger.With("size", len(pms), "offset", pms[0].Offset), func() error {
+		attempt++
+		attemptCtx, cancel := h.withHandlerTimeout(ctx)
+		defer cancel()
+		attemptCtx, span := h.tracer.start(attemptCtx, "tessara.perform", h.tracer.performAttributes(pms[0], h.fromSubqueueID, attributePerformAttempt.Int(attempt), attributeBatchSize.Int(len(pms)))...)
+		err := h.recoverPanic(pms[0], func() error {
+			return h.batchMessageHandler.PerformBatch(attemptCtx, pms)
+		})
+		endSpan(span, err)
+		return err
+	})
 }
 
-// performWithRetry configures the consumer to start consuming from the newest offset.
-func (h retryableHandler) performWithRetry(pm PerformMessage) error {
-	backoffFormula := backoff.NewExponentialBackOff()
-	backoffFormula.Multiplier = h.retryMultiplier
-	backOffWithMaxRetries := backoff.WithMaxRetries(backoffFormula, uint64(h.maxRetry))
-	notify := func(err error, nextWait time.Duration) {
-		logger.Debug().
-			Err(err).
-			Str("retrying in", nextWait.String()).
-			Msg("perform message failed waiting to retry")
+// Fallback calls the fallback of the message handler.
+func (h retryableHandler) Fallback(ctx context.Context, pm PerformMessage, err error) {
+	ctx, span := h.tracer.start(ctx, "tessara.fallback", h.tracer.performAttributes(pm, h.fromSubqueueID)...)
+	panicErr := h.recoverPanic(pm, func() error {
+		h.messageHandler.Fallback(ctx, pm, unwrapExhaustedError(err))
+		return nil
+	})
+	endSpan(span, panicErr)
+}
+
+// FallbackBatch calls the fallback of the batch message handler.
+func (h retryableHandler) FallbackBatch(ctx context.Context, pms []PerformMessage, err error) {
+	ctx, span := h.tracer.start(ctx, "tessara.fallback", h.tracer.performAttributes(pms[0], h.fromSubqueueID, attributeBatchSize.Int(len(pms)))...)
+	panicErr := h.recoverPanic(pms[0], func() error {
+		h.batchMessageHandler.FallbackBatch(ctx, pms, unwrapExhaustedError(err))
+		return nil
+	})
+	endSpan(span, panicErr)
+}
+
+// HasFailureRoute returns true if the message that run out of retries can be routed to the retry topic or dead letter topic,
+// permanent error is never routed to the retry topic.
+func (h retryableHandler) HasFailureRoute(err error) bool {
+	return (h.retryTopicPublisher != nil && !isPermanentError(err)) || h.deadLetterPublisher != nil
+}
+
+// RouteFailure publishes the message that run out of retries to the next retry topic, or to the dead letter topic when there is no next retry topic
+// or the error is permanent.
+func (h retryableHandler) RouteFailure(ctx context.Context, cm *sarama.ConsumerMessage, err error) error {
+	if h.retryTopicPublisher != nil && !isPermanentError(err) {
+		return h.retryTopicPublisher.Publish(ctx, cm, err)
 	}
+	return h.deadLetterPublisher.Publish(ctx, cm, err)
+}
 
-	op := func() error {
-		err := h.messageHandler.Perform(pm)
-		if err != nil {
-			metric.IncrementSubqueueMessageErrorCount(h.fromSubqueueID)
+// recoverPanic runs the handler function and turns the panic into panic error with the stack trace, so one bad message
+// doesn't crash every partition, panic is reported to the error handler if it's implementing HandlePanic.
+func (h retryableHandler) recoverPanic(pm PerformMessage, fn func() error) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
 		}
-		return err
+		panicErr := newPanicError(r)
+		h.metrics.IncrementSubqueueMessagePanicCount(h.fromSubqueueID)
+		if peh, ok := h.errorHandler.(panicErrorHandler); ok {
+			peh.HandlePanic(pm.Topic, pm.Partition, panicErr)
+		}
+		err = panicErr
+	}()
+	return fn()
+}
+
+// withHandlerTimeout derives the context of a perform attempt, the context has no deadline if handler timeout is not set.
+func (h retryableHandler) withHandlerTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if h.handlerTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
-	if err := backoff.RetryNotify(op, backOffWithMaxRetries, notify); err != nil {
-		return err
+	return context.WithTimeout(ctx, h.handlerTimeout)
+}
+
+// perform runs the operation with or without retry depends on max retry.
+func (h retryableHandler) perform(ctx context.Context, l logger.Logger, op func() error) error {
+	switch h.retryPolicy.MaxRetries() {
+	case 0:
+		return h.performWithoutRetry(ctx, l, op)
+	default:
+		return h.performWithRetry(ctx, l, op)
+	}
+}
+
+// performWithoutRetry runs the operation once, context error is returned as it is when the context is cancelled
+// so the message is not treated as failed.
+func (h retryableHandler) performWithoutRetry(ctx context.Context, l logger.Logger, op func() error) error {
+	err := op()
+	if err == nil {
+		return nil
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if h.isSkipped(l, err) {
+		return nil
+	}
+	h.recordFailure(err)
+	return &exhaustedError{err: err, attempts: 1, firstFailedAt: time.Now()}
+}
+
+// performWithRetry runs the operation with backoff of the retry policy until success or max retry is reached,
+// error wrapped by Permanent stops retrying immediately and error wrapped by RetryAfter overrides the backoff interval,
+// waiting for the next retry is stopped when the context is cancelled and context error is returned as it is so the message is not treated as failed.
+func (h retryableHandler) performWithRetry(ctx context.Context, l logger.Logger, op func() error) error {
+	retryBackOff := h.retryPolicy.newBackOff()
+
+	attempts := 0
+	var firstFailedAt time.Time
+	for {
+		attempts++
+		err := op()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if h.isSkipped(l, err) {
+			return nil
+		}
+		h.recordFailure(err)
+		if firstFailedAt.IsZero() {
+			firstFailedAt = time.Now()
+		}
+		if isPermanentError(err) {
+			return &exhaustedError{err: err, attempts: attempts, firstFailedAt: firstFailedAt}
+		}
+
+		nextWait := retryBackOff.NextBackOff()
+		if nextWait == backoff.Stop {
+			return &exhaustedError{err: err, attempts: attempts, firstFailedAt: firstFailedAt}
+		}
+		if delay, ok := retryAfterDelay(err); ok {
+			nextWait = delay
+			h.metrics.IncrementSubqueueMessageRetryAfterCount(h.fromSubqueueID)
+		}
+		l.Warn("perform message failed waiting to retry",
+			"attempt", attempts,
+			"retrying_in", nextWait.String(),
+			"error", err,
+		)
+
+		timer := time.NewTimer(nextWait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isSkipped returns true if the error is wrapped by Skip, skipped message is treated as success.
+func (h retryableHandler) isSkipped(l logger.Logger, err error) bool {
+	if !isSkipError(err) {
+		return false
+	}
+	h.metrics.IncrementSubqueueMessageSkippedCount(h.fromSubqueueID)
+	l.Info("perform message skipped", "error", err)
+	return true
+}
 
-	return nil
+// recordFailure updates the metric of the failed attempt.
+func (h retryableHandler) recordFailure(err error) {
+	h.metrics.IncrementSubqueueMessageErrorCount(h.fromSubqueueID)
+	if isPermanentError(err) {
+		h.metrics.IncrementSubqueueMessagePermanentErrorCount(h.fromSubqueueID)
+	}
+}
+
+// withRetryTopicPublisher sets the retry topic publisher of the handler.
+func (h retryableHandler) withRetryTopicPublisher(rtp *retryTopicPublisher) retryableHandler {
+	h.retryTopicPublisher = rtp
+	return h
+}
+
+// withDeadLetterPublisher sets the dead letter publisher of the handler.
+func (h retryableHandler) withDeadLetterPublisher(dlp *deadLetterPublisher) retryableHandler {
+	h.deadLetterPublisher = dlp
+	return h
+}
+
+// withErrorHandler sets the error handler that panics of the handler are reported to.
+func (h retryableHandler) withErrorHandler(eh errorHandler) retryableHandler {
+	h.errorHandler = eh
+	return h
+}
+
+// withLogger sets the logger of the handler.
+func (h retryableHandler) withLogger(l logger.Logger) retryableHandler {
+	h.logger = l
+	return h
+}
+
+// withMetrics sets the partition metrics that the handler is updating.
+func (h retryableHandler) withMetrics(pm metric.PartitionMetrics) retryableHandler {
+	h.metrics = pm
+	return h
+}
+
+// withTracer sets the tracer that the spans of the handler are started with.
+func (h retryableHandler) withTracer(t messageTracer) retryableHandler {
+	h.tracer = t
+	return h
 }
 
-// withFromSubqueueID configures the consumer to start consuming from the newest offset.
+// withFromSubqueueID sets the subqueue id that the handler is running on.
 func (h retryableHandler) withFromSubqueueID(subqueueID int) retryableHandler {
 	h.fromSubqueueID = subqueueID
 	return h
@@ -0,0 +1,149 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type funcMessageHandler struct {
+	perform  func(ctx context.Context, pm PerformMessage) error
+	fallback func(ctx context.Context, pm PerformMessage, err error)
+}
+
+func (h funcMessageHandler) Perform(ctx context.Context, pm PerformMessage) error {
+	return h.perform(ctx, pm)
+}
+
+func (h funcMessageHandler) Fallback(ctx context.Context, pm PerformMessage, err error) {
+	if h.fallback != nil {
+		h.fallback(ctx, pm, err)
+	}
+}
+
+func TestPermanentErrorStopsRetry(t *testing.T) {
+	attempts := 0
+	rh := newRetryableHandler(funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		attempts++
+		return Permanent(errors.New("invalid payload"))
+	}}, NewExponentialRetryPolicy(3, 500*time.Millisecond, 1.5), 0)
+
+	err := rh.Perform(context.Background(), PerformMessage{})
+
+	ee, ok := asExhaustedError(err)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, ee.attempts, 1)
+	assert.Equal(t, attempts, 1)
+	assert.Equal(t, isPermanentError(err), true)
+}
+
+func TestRetryAfterErrorUsesGivenDelay(t *testing.T) {
+	attempts := 0
+	rh := newRetryableHandler(funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		attempts++
+		if attempts == 1 {
+			return RetryAfter(errors.New("rate limited"), 10*time.Millisecond)
+		}
+		return nil
+	}}, NewExponentialRetryPolicy(3, 500*time.Millisecond, 1.5), 0)
+
+	start := time.Now()
+	err := rh.Perform(context.Background(), PerformMessage{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, attempts, 2)
+	// default initial backoff interval is 500 millisecs
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+}
+
+func TestSkipErrorIsTreatedAsSuccess(t *testing.T) {
+	attempts := 0
+	rh := newRetryableHandler(funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		attempts++
+		return Skip(errors.New("unknown event type"))
+	}}, NewExponentialRetryPolicy(3, 500*time.Millisecond, 1.5), 0)
+
+	assert.NoError(t, rh.Perform(context.Background(), PerformMessage{}))
+	assert.Equal(t, attempts, 1)
+}
+
+func TestHandlerTimeoutCancelsPerformAttempt(t *testing.T) {
+	rh := newRetryableHandler(funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}, NewExponentialRetryPolicy(0, 500*time.Millisecond, 1.5), 10*time.Millisecond)
+
+	err := rh.Perform(context.Background(), PerformMessage{})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// funcBatchMessageHandler is the context batch message handler of the given function
+type funcBatchMessageHandler struct {
+	performBatch  func(ctx context.Context, pms []PerformMessage) error
+	fallbackBatch func(ctx context.Context, pms []PerformMessage, err error)
+}
+
+func (h funcBatchMessageHandler) PerformBatch(ctx context.Context, pms []PerformMessage) error {
+	return h.performBatch(ctx, pms)
+}
+
+func (h funcBatchMessageHandler) FallbackBatch(ctx context.Context, pms []PerformMessage, err error) {
+	if h.fallbackBatch != nil {
+		h.fallbackBatch(ctx, pms, err)
+	}
+}
+
+func TestHandlerTimeoutCancelsPerformBatchAttempt(t *testing.T) {
+	rh := newBatchRetryableHandler(funcBatchMessageHandler{performBatch: func(ctx context.Context, pms []PerformMessage) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}, NewExponentialRetryPolicy(0, 500*time.Millisecond, 1.5), 10*time.Millisecond)
+
+	err := rh.PerformBatch(context.Background(), []PerformMessage{{}})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+type panicRecorderErrorHandler struct {
+	loggingErrorHandler
+	panics []*PanicError
+}
+
+func (eh *panicRecorderErrorHandler) HandlePanic(topic string, partition int32, err *PanicError) {
+	eh.panics = append(eh.panics, err)
+}
+
+func TestPanicIsRecoveredAndRetried(t *testing.T) {
+	attempts := 0
+	eh := &panicRecorderErrorHandler{}
+	rh := newRetryableHandler(funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		attempts++
+		panic("nil map")
+	}}, NewConstantRetryPolicy(2, time.Millisecond), 0).withErrorHandler(eh)
+
+	err := rh.Perform(context.Background(), PerformMessage{Topic: "orders"})
+
+	var panicErr *PanicError
+	assert.Equal(t, errors.As(err, &panicErr), true)
+	assert.Equal(t, panicErr.Value, "nil map")
+	assert.Contains(t, string(panicErr.Stack), "TestPanicIsRecoveredAndRetried")
+	assert.Equal(t, attempts, 3)
+	assert.Len(t, eh.panics, 3)
+}
+
+func TestCancelledContextIsNotExhausted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rh := newRetryableHandler(funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		cancel()
+		return errors.New("connection reset")
+	}}, NewExponentialRetryPolicy(3, time.Hour, 1.5), 0)
+
+	err := rh.Perform(ctx, PerformMessage{})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, ok := asExhaustedError(err)
+	assert.False(t, ok)
+}
@@ -2,9 +2,9 @@ package tessara
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
-
-	"github.com/mrbryside/tessara/logger"
 )
 
 // qualifier is an interface that defines the Qualify method.
@@ -19,6 +19,9 @@ type subqueueQualifier struct {
 	subqueues []*subqueue
 
 	pushMessageBlockingInterval time.Duration
+
+	// done is closed once the qualifier is stopped by the context
+	done chan struct{}
 }
 
 // newSubqueueQualifier creates a new SubqueueQualifier instance.
@@ -27,23 +30,29 @@ func newSubqueueQualifier(ctx context.Context,
 	qualifierMode string,
 	memoryBufferSize uint64,
 	pushMessageBlockingInterval time.Duration,
-) *subqueueQualifier {
+) (*subqueueQualifier, error) {
 	if len(sqs) == 0 {
-		panic("subqueue list is empty")
+		return nil, errors.New("subqueue list is empty")
+	}
+	q, err := getQualifier(qualifierMode)
+	if err != nil {
+		return nil, err
 	}
 	subqueueQualifierChannelBufferSize := memoryBufferSize
 	sq := &subqueueQualifier{
 		receiver:                    make(chan subqueueMessage, subqueueQualifierChannelBufferSize),
-		qualifier:                   getQualifier(qualifierMode),
+		qualifier:                   q,
 		subqueues:                   sqs,
 		pushMessageBlockingInterval: pushMessageBlockingInterval,
+		done:                        make(chan struct{}),
 	}
 
 	go func() {
+		defer close(sq.done)
 		sq.StartQualify(ctx)
 	}()
 
-	return sq
+	return sq, nil
 }
 
 // StartQualify starts the qualifier process.
@@ -57,33 +66,36 @@ func (sq *subqueueQualifier) StartQualify(ctx context.Context) {
 				return
 			}
 			targetSubqueue := sq.qualifier.Qualify(string(sqMsg.consumerMessage.Key), sq.subqueues)
-			targetSubqueue.Push(ctx, sqMsg)
+			if err := targetSubqueue.Push(ctx, sqMsg); err != nil {
+				// claim is ended before the message is handled
+				sqMsg.trace.cancel(err)
+			}
 		}
 	}
 }
 
-// Push pushes a message to the orchestrator
-func (sq *subqueueQualifier) Push(ctx context.Context, sqMsg subqueueMessage) {
+// Push pushes a message to the qualifier, it returns the context error when context is done before it's pushed
+func (sq *subqueueQualifier) Push(ctx context.Context, sqMsg subqueueMessage) error {
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return ctx.Err()
 		case sq.receiver <- sqMsg:
-			return
+			return nil
 		default:
 			time.Sleep(sq.pushMessageBlockingInterval)
 		}
 	}
 }
 
-func getQualifier(qualifierMode string) qualifier {
+// getQualifier returns the qualifier of the qualifier mode
+func getQualifier(qualifierMode string) (qualifier, error) {
 	switch qualifierMode {
 	case "round_robin":
-		return newRoundRobinQualifier()
+		return newRoundRobinQualifier(), nil
 	case "key_distribute":
-		return newKeyDistributeQualifier()
+		return newKeyDistributeQualifier(), nil
 	default:
-		logger.Panic().Msg("invalid qualifier mode")
+		return nil, fmt.Errorf("invalid qualifier mode %s", qualifierMode)
 	}
-	return nil
 }
@@ -0,0 +1,237 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mrbryside/tessara/logger"
+	"github.com/mrbryside/tessara/metric"
+)
+
+type batchRecorderHandler struct {
+	mu      sync.Mutex
+	batches [][]PerformMessage
+}
+
+func (h *batchRecorderHandler) PerformBatch(pms []PerformMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.batches = append(h.batches, pms)
+	return nil
+}
+
+func (h *batchRecorderHandler) FallbackBatch(pms []PerformMessage, err error) {}
+
+func (h *batchRecorderHandler) Batches() [][]PerformMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.batches
+}
+
+func TestBatchHandledWhenReachMaxSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := &batchRecorderHandler{}
+	sq := newSubqueue(ctx, 1, newBatchRetryableHandler(batchMessageHandlerAdapter{h}, NewExponentialRetryPolicy(0, 500*time.Millisecond, 1.5), 0), 10, 10*time.Millisecond, 2, 1*time.Hour, FailurePolicyBlock, make(chan error), logger.Default(), metric.Discard())
+
+	msgBuffer := newMessageBuffer(1)
+	msgBuffer2 := newMessageBuffer(2)
+	sq.Push(ctx, subqueueMessage{consumerMessage: &sarama.ConsumerMessage{Offset: 1}, messageBuffer: msgBuffer})
+	sq.Push(ctx, subqueueMessage{consumerMessage: &sarama.ConsumerMessage{Offset: 2}, messageBuffer: msgBuffer2})
+
+	assert.Eventually(t, func() bool { return len(h.Batches()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Len(t, h.Batches()[0], 2)
+	assert.Equal(t, msgBuffer.IsMarkSuccess(), true)
+	assert.Equal(t, msgBuffer2.IsMarkSuccess(), true)
+}
+
+func TestBatchHandledWhenMaxLingerPassed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := &batchRecorderHandler{}
+	sq := newSubqueue(ctx, 1, newBatchRetryableHandler(batchMessageHandlerAdapter{h}, NewExponentialRetryPolicy(0, 500*time.Millisecond, 1.5), 0), 10, 10*time.Millisecond, 100, 100*time.Millisecond, FailurePolicyBlock, make(chan error), logger.Default(), metric.Discard())
+
+	msgBuffer := newMessageBuffer(1)
+	sq.Push(ctx, subqueueMessage{consumerMessage: &sarama.ConsumerMessage{Offset: 1}, messageBuffer: msgBuffer})
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, h.Batches(), 0)
+	assert.Eventually(t, func() bool { return len(h.Batches()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, msgBuffer.IsMarkSuccess(), true)
+}
+
+func TestFailurePolicyMarkDoneMarksFailedMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rh := newRetryableHandler(funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		return errors.New("failed")
+	}}, NewExponentialRetryPolicy(0, 500*time.Millisecond, 1.5), 0)
+	sq := newSubqueue(ctx, 1, rh, 10, 10*time.Millisecond, 100, 100*time.Millisecond, FailurePolicyMarkDone, make(chan error), logger.Default(), metric.Discard())
+
+	msgBuffer := newMessageBuffer(1)
+	sq.Push(ctx, subqueueMessage{consumerMessage: &sarama.ConsumerMessage{Offset: 1}, messageBuffer: msgBuffer})
+
+	assert.Eventually(t, msgBuffer.IsMarkSuccess, time.Second, 10*time.Millisecond)
+}
+
+func TestFailurePolicyStopPartitionPushesError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rh := newRetryableHandler(funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		return errors.New("failed")
+	}}, NewExponentialRetryPolicy(0, 500*time.Millisecond, 1.5), 0)
+	failureErrorChan := make(chan error)
+	sq := newSubqueue(ctx, 1, rh, 10, 10*time.Millisecond, 100, 100*time.Millisecond, FailurePolicyStopPartition, failureErrorChan, logger.Default(), metric.Discard())
+
+	msgBuffer := newMessageBuffer(1)
+	sq.Push(ctx, subqueueMessage{consumerMessage: &sarama.ConsumerMessage{Offset: 1}, messageBuffer: msgBuffer})
+
+	select {
+	case err := <-failureErrorChan:
+		assert.EqualError(t, err, "failed")
+	case <-time.After(time.Second):
+		t.Fatal("failure error is not pushed")
+	}
+	assert.Equal(t, msgBuffer.IsMarkSuccess(), false)
+}
+
+func TestRevokedClaimLeavesInFlightMessageUncommitted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	var fallbackCalled atomic.Bool
+	rh := newRetryableHandler(funcMessageHandler{
+		perform: func(ctx context.Context, pm PerformMessage) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		fallback: func(ctx context.Context, pm PerformMessage, err error) {
+			fallbackCalled.Store(true)
+		},
+	}, NewExponentialRetryPolicy(0, 500*time.Millisecond, 1.5), 0)
+	// mock producer without expectation fails the test when the message is dead lettered
+	mp := mocks.NewSyncProducer(t, nil)
+	rh = rh.withDeadLetterPublisher(newDeadLetterPublisher(syncProducer{Producer: mp, logger: logger.Default()}, "orders.dlq"))
+	sq := newSubqueue(ctx, 1, rh, 10, 10*time.Millisecond, 100, 100*time.Millisecond, FailurePolicyMarkDone, make(chan error), logger.Default(), metric.Discard())
+
+	msgBuffer := newMessageBuffer(1)
+	sq.Push(ctx, subqueueMessage{consumerMessage: &sarama.ConsumerMessage{Topic: "orders", Offset: 1}, messageBuffer: msgBuffer})
+	<-started
+	cancel()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, fallbackCalled.Load())
+	assert.False(t, msgBuffer.IsMarkSuccess())
+}
+
+func TestMessageContextCarriesTopicPartitionOffset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type messageValues struct {
+		topic     string
+		partition int32
+		offset    int64
+	}
+	got := make(chan messageValues, 1)
+	rh := newRetryableHandler(funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		topic, _ := TopicFromContext(ctx)
+		partition, _ := PartitionFromContext(ctx)
+		offset, _ := OffsetFromContext(ctx)
+		got <- messageValues{topic: topic, partition: partition, offset: offset}
+		return nil
+	}}, NewExponentialRetryPolicy(0, 500*time.Millisecond, 1.5), 0)
+	sq := newSubqueue(ctx, 1, rh, 10, 10*time.Millisecond, 100, 100*time.Millisecond, FailurePolicyBlock, make(chan error), logger.Default(), metric.Discard())
+
+	sq.Push(ctx, subqueueMessage{consumerMessage: &sarama.ConsumerMessage{Topic: "orders", Partition: 3, Offset: 42}, messageBuffer: newMessageBuffer(42)})
+
+	select {
+	case v := <-got:
+		assert.Equal(t, messageValues{topic: "orders", partition: 3, offset: 42}, v)
+	case <-time.After(time.Second):
+		t.Fatal("message is not performed")
+	}
+	_, ok := TopicFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func TestRevokedClaimLeavesInFlightBatchUncommitted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	var fallbackCalled atomic.Bool
+	rh := newBatchRetryableHandler(funcBatchMessageHandler{
+		performBatch: func(ctx context.Context, pms []PerformMessage) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		fallbackBatch: func(ctx context.Context, pms []PerformMessage, err error) {
+			fallbackCalled.Store(true)
+		},
+	}, NewExponentialRetryPolicy(0, 500*time.Millisecond, 1.5), 0)
+	sq := newSubqueue(ctx, 1, rh, 10, 10*time.Millisecond, 1, time.Hour, FailurePolicyMarkDone, make(chan error), logger.Default(), metric.Discard())
+
+	msgBuffer := newMessageBuffer(1)
+	sq.Push(ctx, subqueueMessage{consumerMessage: &sarama.ConsumerMessage{Topic: "orders", Offset: 1}, messageBuffer: msgBuffer})
+	<-started
+	cancel()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, fallbackCalled.Load())
+	assert.False(t, msgBuffer.IsMarkSuccess())
+}
+
+func TestFailedMessageIsNoLongerCountedAsProcessing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := metric.NewMetrics("", []float64{0.1, 1})
+	processing := func(subqueueID string) float64 {
+		return testutil.ToFloat64(m.SubqueueMessageProcessingCount.With(prometheus.Labels{"group": "orders-group", "topic": "orders", "partition": "0", "subqueueId": subqueueID}))
+	}
+	pm := m.Partition("orders-group", "orders", 0)
+
+	fallbacks := make(chan struct{}, 2)
+	rh := newRetryableHandler(funcMessageHandler{
+		perform:  func(ctx context.Context, pm PerformMessage) error { return errors.New("failed") },
+		fallback: func(ctx context.Context, pm PerformMessage, err error) { fallbacks <- struct{}{} },
+	}, NewExponentialRetryPolicy(0, time.Millisecond, 1), 0)
+	sq := newSubqueue(ctx, 1, rh, 10, time.Millisecond, 100, 100*time.Millisecond, FailurePolicyBlock, make(chan error), logger.Default(), pm)
+	msgBuffer := newMessageBuffer(1)
+	sq.Push(ctx, subqueueMessage{consumerMessage: &sarama.ConsumerMessage{Offset: 1}, messageBuffer: msgBuffer})
+
+	brh := newBatchRetryableHandler(funcBatchMessageHandler{
+		performBatch:  func(ctx context.Context, pms []PerformMessage) error { return errors.New("failed") },
+		fallbackBatch: func(ctx context.Context, pms []PerformMessage, err error) { fallbacks <- struct{}{} },
+	}, NewExponentialRetryPolicy(0, time.Millisecond, 1), 0)
+	bsq := newSubqueue(ctx, 2, brh, 10, time.Millisecond, 2, time.Hour, FailurePolicyBlock, make(chan error), logger.Default(), pm)
+	batchBuffers := []*messageBuffer{newMessageBuffer(2), newMessageBuffer(3)}
+	for _, b := range batchBuffers {
+		bsq.Push(ctx, subqueueMessage{consumerMessage: &sarama.ConsumerMessage{Offset: b.Offset()}, messageBuffer: b})
+	}
+
+	receiveWithin(t, fallbacks)
+	receiveWithin(t, fallbacks)
+	// blocked messages are not marked success but they're not processing anymore
+	assert.Eventually(t, func() bool { return processing("1") == 0 && processing("2") == 0 }, time.Second, time.Millisecond)
+	assert.False(t, msgBuffer.IsMarkSuccess())
+	assert.False(t, batchBuffers[0].IsMarkSuccess())
+}
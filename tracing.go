@@ -0,0 +1,231 @@
+package tessara
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans created by tessara
+const tracerName = "github.com/mrbryside/tessara"
+
+// propagator propagates W3C trace context and baggage through record headers
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// span attributes of the message
+const (
+	attributeMessagingSystem    = attribute.Key("messaging.system")
+	attributeMessagingTopic     = attribute.Key("messaging.destination.name")
+	attributeMessagingPartition = attribute.Key("messaging.destination.partition.id")
+	attributeMessagingOffset    = attribute.Key("messaging.kafka.offset")
+	attributeMessagingGroup     = attribute.Key("messaging.consumer.group.name")
+	attributeSubqueueID         = attribute.Key("tessara.subqueue.id")
+	attributePerformAttempt     = attribute.Key("tessara.perform.attempt")
+	attributeBatchSize          = attribute.Key("tessara.batch.size")
+)
+
+// headersCarrier adapts the headers of the producer message to propagation.TextMapCarrier
+type headersCarrier struct {
+	headers *Headers
+}
+
+// Get returns the value of the first header with the given key
+func (hc headersCarrier) Get(key string) string {
+	v, _ := hc.headers.Get(key)
+	return string(v)
+}
+
+// Set replaces the value of the header with the given key or appends the header if it's not included
+func (hc headersCarrier) Set(key, value string) {
+	for i, h := range *hc.headers {
+		if h.Key == key {
+			(*hc.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*hc.headers = append(*hc.headers, Header{Key: key, Value: []byte(value)})
+}
+
+// Keys returns the keys of the headers
+func (hc headersCarrier) Keys() []string {
+	keys := make([]string, 0, len(*hc.headers))
+	for _, h := range *hc.headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+// messageTracer starts the spans of the produce and the consume pipeline
+type messageTracer struct {
+	tracer trace.Tracer
+	group  string
+}
+
+// newMessageTracer creates a message tracer of the tracer provider, group is only set for the consumer
+func newMessageTracer(tp trace.TracerProvider, group string) messageTracer {
+	return messageTracer{
+		tracer: tp.Tracer(tracerName),
+		group:  group,
+	}
+}
+
+// startProduce starts the producer span of the message and injects its context into the headers
+func (t messageTracer) startProduce(ctx context.Context, pm *ProducerMessage) (context.Context, trace.Span) {
+	ctx, span := t.tracer.Start(ctx, pm.Topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attributeMessagingSystem.String("kafka"),
+			attributeMessagingTopic.String(pm.Topic),
+		),
+	)
+	propagator.Inject(ctx, headersCarrier{headers: &pm.Headers})
+	return ctx, span
+}
+
+// startMessage extracts the context of the consumer message from its headers and starts the process span of the message,
+// memory buffer wait span is started as the first step of the pipeline
+func (t messageTracer) startMessage(cm *sarama.ConsumerMessage) messageTrace {
+	headers := fromSaramaHeaders(cm.Headers)
+	ctx := propagator.Extract(context.Background(), headersCarrier{headers: &headers})
+	ctx, processSpan := t.tracer.Start(ctx, cm.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(t.messageAttributes(cm)...),
+	)
+	_, waitSpan := t.start(ctx, "tessara.memory_buffer.wait", t.messageAttributes(cm)...)
+	return messageTrace{
+		tracer:      t,
+		cm:          cm,
+		ctx:         ctx,
+		processSpan: processSpan,
+		waitSpan:    waitSpan,
+	}
+}
+
+// start starts a child span of the context
+func (t messageTracer) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// startBatch starts the span of the batch that is linked to the process span of every message in the batch
+func (t messageTracer) startBatch(ctx context.Context, batch []subqueueMessage) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(batch))
+	for _, msg := range batch {
+		if msg.trace.ctx != nil {
+			links = append(links, trace.LinkFromContext(msg.trace.ctx))
+		}
+	}
+	return t.tracer.Start(ctx, batch[0].consumerMessage.Topic+" process batch",
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			attributeMessagingSystem.String("kafka"),
+			attributeMessagingTopic.String(batch[0].consumerMessage.Topic),
+			attributeMessagingPartition.Int(int(batch[0].consumerMessage.Partition)),
+			attributeMessagingOffset.Int64(batch[0].consumerMessage.Offset),
+			attributeBatchSize.Int(len(batch)),
+		),
+	)
+}
+
+// performAttributes returns the span attributes of the perform message handling on the subqueue
+func (t messageTracer) performAttributes(pm PerformMessage, subqueueID int, attrs ...attribute.KeyValue) []attribute.KeyValue {
+	return append([]attribute.KeyValue{
+		attributeMessagingSystem.String("kafka"),
+		attributeMessagingTopic.String(pm.Topic),
+		attributeMessagingPartition.Int(int(pm.Partition)),
+		attributeMessagingOffset.Int64(pm.Offset),
+		attributeSubqueueID.Int(subqueueID),
+	}, attrs...)
+}
+
+// messageAttributes returns the span attributes of the consumer message
+func (t messageTracer) messageAttributes(cm *sarama.ConsumerMessage) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attributeMessagingSystem.String("kafka"),
+		attributeMessagingTopic.String(cm.Topic),
+		attributeMessagingPartition.Int(int(cm.Partition)),
+		attributeMessagingOffset.Int64(cm.Offset),
+	}
+	if t.group != "" {
+		attrs = append(attrs, attributeMessagingGroup.String(t.group))
+	}
+	return attrs
+}
+
+// messageTrace represents the spans of a message in the consume pipeline, zero value is not tracing anything
+type messageTrace struct {
+	tracer      messageTracer
+	cm          *sarama.ConsumerMessage
+	ctx         context.Context
+	processSpan trace.Span
+	waitSpan    trace.Span
+}
+
+// startSubqueueWait ends the memory buffer wait span and starts the subqueue wait span
+func (mt messageTrace) startSubqueueWait() messageTrace {
+	if mt.ctx == nil {
+		return mt
+	}
+	mt.waitSpan.End()
+	_, mt.waitSpan = mt.tracer.start(mt.ctx, "tessara.subqueue.wait", mt.tracer.messageAttributes(mt.cm)...)
+	return mt
+}
+
+// endSubqueueWait ends the subqueue wait span once the subqueue starts handling the message
+func (mt messageTrace) endSubqueueWait(subqueueID int) {
+	if mt.ctx == nil {
+		return
+	}
+	mt.processSpan.SetAttributes(attributeSubqueueID.Int(subqueueID))
+	mt.waitSpan.SetAttributes(attributeSubqueueID.Int(subqueueID))
+	mt.waitSpan.End()
+}
+
+// contextWithTrace returns the context carrying the process span and baggage of the message, cancellation is still following ctx
+func (mt messageTrace) contextWithTrace(ctx context.Context) context.Context {
+	if mt.ctx == nil {
+		return ctx
+	}
+	ctx = trace.ContextWithSpan(ctx, mt.processSpan)
+	return baggage.ContextWithBaggage(ctx, baggage.FromContext(mt.ctx))
+}
+
+// end ends the process span of the message with the error of the message
+func (mt messageTrace) end(err error) {
+	if mt.ctx == nil {
+		return
+	}
+	endSpan(mt.processSpan, err)
+}
+
+// cancel ends the wait span and the process span with the error when the message is dropped before it's handled
+func (mt messageTrace) cancel(err error) {
+	if mt.ctx == nil {
+		return
+	}
+	endSpan(mt.waitSpan, err)
+	endSpan(mt.processSpan, err)
+}
+
+// endSpan records the error to the span if it's not nil then ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// endBatchTrace ends the batch span and the process span of every message in the batch with the error of the batch
+func endBatchTrace(batchSpan trace.Span, batch []subqueueMessage, err error) {
+	for _, msg := range batch {
+		msg.trace.end(err)
+	}
+	if batchSpan != nil {
+		endSpan(batchSpan, err)
+	}
+}
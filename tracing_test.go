@@ -0,0 +1,126 @@
+package tessara
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/mrbryside/tessara/logger"
+	"github.com/mrbryside/tessara/metric"
+)
+
+func TestProduceContextInjectsTraceContext(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	mp := mocks.NewSyncProducer(t, nil)
+	var traceparent string
+	mp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		for _, h := range msg.Headers {
+			if string(h.Key) == "traceparent" {
+				traceparent = string(h.Value)
+			}
+		}
+		return nil
+	})
+	sp := syncProducer{Producer: mp, logger: logger.Default(), tracer: newMessageTracer(tp, "")}
+
+	_, _, err := sp.ProduceContext(context.Background(), ProducerMessage{Topic: "orders", Value: []byte("v")})
+	assert.NoError(t, err)
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "orders publish", spans[0].Name())
+	assert.Contains(t, traceparent, spans[0].SpanContext().TraceID().String())
+}
+
+func TestConsumePipelineSpansContinueProducerTrace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	mt := newMessageTracer(tp, "group")
+
+	// producer side trace context is carried by the record headers
+	producerCtx, producerSpan := tp.Tracer("test").Start(context.Background(), "producer")
+	headers := Headers{}
+	propagator.Inject(producerCtx, headersCarrier{headers: &headers})
+	producerSpan.End()
+
+	attempt := 0
+	rh := newRetryableHandler(funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		attempt++
+		if attempt == 1 {
+			return errors.New("failed")
+		}
+		return nil
+	}}, NewExponentialRetryPolicy(1, time.Millisecond, 1), 0).withTracer(mt)
+	sq := newSubqueue(ctx, 2, rh, 10, 10*time.Millisecond, 100, 100*time.Millisecond, FailurePolicyBlock, make(chan error), logger.Default(), metric.Discard())
+
+	cm := &sarama.ConsumerMessage{Topic: "orders", Partition: 3, Offset: 7}
+	for _, h := range toSaramaHeaders(headers) {
+		cm.Headers = append(cm.Headers, &h)
+	}
+	msgBuffer := newMessageBuffer(cm.Offset)
+	sq.Push(ctx, subqueueMessage{consumerMessage: cm, messageBuffer: msgBuffer, trace: mt.startMessage(cm).startSubqueueWait()})
+
+	assert.Eventually(t, func() bool { return len(sr.Ended()) == 6 }, time.Second, 10*time.Millisecond)
+
+	names := map[string]int{}
+	for _, s := range sr.Ended() {
+		names[s.Name()]++
+		assert.Equal(t, producerSpan.SpanContext().TraceID(), s.SpanContext().TraceID())
+		if s.Name() == "orders process" {
+			assert.Equal(t, producerSpan.SpanContext().SpanID(), s.Parent().SpanID())
+			assert.Contains(t, s.Attributes(), attributeMessagingOffset.Int64(7))
+			assert.Contains(t, s.Attributes(), attributeSubqueueID.Int(2))
+		}
+	}
+	assert.Equal(t, map[string]int{
+		"producer":                   1,
+		"orders process":             1,
+		"tessara.memory_buffer.wait": 1,
+		"tessara.subqueue.wait":      1,
+		"tessara.perform":            2,
+	}, names)
+	assert.True(t, msgBuffer.IsMarkSuccess())
+}
+
+func TestOrchestratorEndsSpansWhenClaimIsEndedWhileWaitingForBuffer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	// memory buffer is full until the claim is ended
+	mb := newMemoryBuffer(ctx, 1, time.Millisecond, time.Millisecond, metric.Discard())
+	mb.Push(ctx, newMessageBuffer(1))
+	sqs := newSubqueues(ctx, newRetryableHandler(funcMessageHandler{perform: func(ctx context.Context, pm PerformMessage) error {
+		return nil
+	}}, NewExponentialRetryPolicy(0, time.Millisecond, 1), 0), 1, time.Millisecond, 1, 100, 100*time.Millisecond, FailurePolicyBlock, make(chan error), logger.Default(), metric.Discard())
+	sqq, err := newSubqueueQualifier(ctx, sqs, "round_robin", 1, time.Millisecond)
+	assert.NoError(t, err)
+	o := newOrchestrator(ctx, mb, sqq, nil, newMessageTracer(tp, "group"), 1, time.Millisecond)
+
+	o.Push(ctx, &sarama.ConsumerMessage{Topic: "orders", Partition: 3, Offset: 2})
+	assert.Eventually(t, func() bool { return len(sr.Started()) == 2 }, time.Second, time.Millisecond)
+	assert.Empty(t, sr.Ended())
+
+	cancel()
+	<-o.done
+	assert.Len(t, sr.Ended(), 2)
+	for _, s := range sr.Ended() {
+		assert.Equal(t, codes.Error, s.Status().Code)
+		assert.Equal(t, context.Canceled.Error(), s.Status().Description)
+	}
+}